@@ -0,0 +1,256 @@
+// Package canonicalizer implements the JSON Canonicalization Scheme (JCS) defined in RFC 8785.
+//
+// The canonical form sorts object members by the UTF-16 code units of their names, serializes
+// numbers the way ECMAScript does and only escapes the characters JSON requires, so payloads
+// signed by another language produce the exact same bytes.
+package canonicalizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrInexactNumber is returned by CanonicalizeExact for a json.Number that an IEEE 754 double
+// cannot hold exactly, such as an integer above 2^53 or a decimal with more than 17 significant
+// digits.
+var ErrInexactNumber = errors.New("not exactly representable as an IEEE 754 double")
+
+// Canonicalize returns the RFC 8785 canonical form of a decoded JSON value.
+func Canonicalize(value interface{}) ([]byte, error) {
+	return canonicalize(value, false)
+}
+
+// CanonicalizeExact is Canonicalize, except that numbers decoded as json.Number must be exactly
+// representable as doubles. RFC 8785 serializes numbers as doubles, so 9007199254740993 has the
+// same canonical form as 9007199254740992: signing it would sign both.
+func CanonicalizeExact(value interface{}) ([]byte, error) {
+	return canonicalize(value, true)
+}
+
+func canonicalize(value interface{}, exact bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := write(&buf, value, exact); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Transform parses a JSON document and returns its RFC 8785 canonical form.
+func Transform(document []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+
+	return Canonicalize(value)
+}
+
+func write(buf *bytes.Buffer, value interface{}, exact bool) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case string:
+		return writeString(buf, v)
+	case json.Number:
+		return writeJSONNumber(buf, v, exact)
+	case float64:
+		return writeNumber(buf, v)
+	case float32:
+		return writeNumber(buf, float64(v))
+	case int:
+		return writeNumber(buf, float64(v))
+	case int64:
+		return writeNumber(buf, float64(v))
+	case int32:
+		return writeNumber(buf, float64(v))
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := write(buf, elem, exact); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		return writeObject(buf, v, exact)
+	default:
+		return fmt.Errorf("unsupported type %T", value)
+	}
+	return nil
+}
+
+func writeObject(buf *bytes.Buffer, object map[string]interface{}, exact bool) error {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lessUTF16(keys[i], keys[j])
+	})
+
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeString(buf, key); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := write(buf, object[key], exact); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as required by RFC 8785 section 3.2.3.
+func lessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+func writeString(buf *bytes.Buffer, s string) error {
+	if !utf8.ValidString(s) {
+		return errors.New("invalid UTF-8 string")
+	}
+
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return nil
+}
+
+// writeJSONNumber serializes a number as written in a JSON document. When exact is set, it fails
+// if the double it is serialized as has another value.
+func writeJSONNumber(buf *bytes.Buffer, number json.Number, exact bool) error {
+	f, err := strconv.ParseFloat(string(number), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", number)
+	}
+
+	var formatted bytes.Buffer
+	if err := writeNumber(&formatted, f); err != nil {
+		return err
+	}
+	if exact && !sameDecimal(string(number), formatted.String()) {
+		return fmt.Errorf("number %s is %w", number, ErrInexactNumber)
+	}
+
+	buf.Write(formatted.Bytes())
+	return nil
+}
+
+// sameDecimal reports whether two JSON numbers have the same decimal value, however they are
+// written: 1.50, 15e-1 and 1.5 are the same.
+func sameDecimal(a, b string) bool {
+	aNegative, aDigits, aExponent, aOk := decimal(a)
+	bNegative, bDigits, bExponent, bOk := decimal(b)
+	return aOk && bOk && aNegative == bNegative && aDigits == bDigits && aExponent == bExponent
+}
+
+// decimal splits a JSON number into its sign and the significant digits and exponent of its
+// value, digits * 10^exponent, without leading or trailing zeros. Zero has no digits and no sign.
+func decimal(number string) (bool, string, int, bool) {
+	negative := strings.HasPrefix(number, "-")
+	number = strings.TrimPrefix(number, "-")
+
+	exponent := 0
+	if i := strings.IndexAny(number, "eE"); i >= 0 {
+		e, err := strconv.Atoi(strings.TrimPrefix(number[i+1:], "+"))
+		if err != nil {
+			return false, "", 0, false
+		}
+		exponent = e
+		number = number[:i]
+	}
+
+	integer, fraction, _ := strings.Cut(number, ".")
+	digits := strings.TrimLeft(integer+fraction, "0")
+	exponent -= len(fraction)
+	trimmed := strings.TrimRight(digits, "0")
+	exponent += len(digits) - len(trimmed)
+
+	if trimmed == "" {
+		return false, "", 0, true
+	}
+	return negative, trimmed, exponent, true
+}
+
+// writeNumber serializes a number like ECMAScript's Number.prototype.toString, as required by
+// RFC 8785 section 3.2.2.3.
+func writeNumber(buf *bytes.Buffer, f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return errors.New("NaN and Infinity are not valid JSON numbers")
+	}
+	if f == 0 {
+		// Also covers negative zero
+		buf.WriteByte('0')
+		return nil
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		format = 'e'
+	}
+
+	formatted := strconv.FormatFloat(f, format, -1, 64)
+	if format == 'e' {
+		// Go pads exponents to two digits ("1e-07"), ECMAScript does not ("1e-7")
+		if i := strings.IndexByte(formatted, 'e'); i > 0 && formatted[i+2] == '0' {
+			formatted = formatted[:i+2] + formatted[i+3:]
+		}
+	}
+
+	buf.WriteString(formatted)
+	return nil
+}
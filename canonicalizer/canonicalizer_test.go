@@ -0,0 +1,210 @@
+package canonicalizer
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors published with RFC 8785 (https://github.com/cyberphone/json-canonicalization/tree/master/testdata)
+var rfcTestVectors = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{
+		name:     "arrays",
+		input:    `[56, {"d": true, "10": null, "1": [ ]}]`,
+		expected: `[56,{"1":[],"10":null,"d":true}]`,
+	},
+	{
+		name: "french",
+		input: `{
+			"peach": "This sorting order",
+			"péché": "is wrong according to French",
+			"pêche": "but canonicalization MUST",
+			"sin":   "ignore locale"
+		}`,
+		expected: `{"peach":"This sorting order","péché":"is wrong according to French","pêche":"but canonicalization MUST","sin":"ignore locale"}`,
+	},
+	{
+		name: "structures",
+		input: `{
+			"1": {"f": {"f": "hi","F": 5} ,"\n": 56.0},
+			"10": { },
+			"": "empty",
+			"a": { },
+			"111": [ {"e": "yes","E": "no" } ],
+			"A": { }
+		}`,
+		expected: `{"":"empty","1":{"\n":56,"f":{"F":5,"f":"hi"}},"10":{},"111":[{"E":"no","e":"yes"}],"A":{},"a":{}}`,
+	},
+	{
+		name:     "unicode",
+		input:    `{"Unnormalized Unicode":"A\u030a"}`,
+		expected: "{\"Unnormalized Unicode\":\"A\u030a\"}",
+	},
+	{
+		name: "values",
+		input: `{
+			"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+			"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+			"literals": [null, true, false]
+		}`,
+		expected: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+	},
+	{
+		name: "weird",
+		input: `{
+			"\u20ac": "Euro Sign",
+			"\r": "Carriage Return",
+			"\u000a": "Newline",
+			"1": "One",
+			"\u0080": "Control\u007f",
+			"\ud83d\ude02": "Smiley",
+			"\u00f6": "Latin Small Letter O With Diaeresis",
+			"\ufb33": "Hebrew Letter Dalet With Dagesh",
+			"</script>": "Browser Challenge"
+		}`,
+		expected: "{\"\\n\":\"Newline\",\"\\r\":\"Carriage Return\",\"1\":\"One\",\"</script>\":\"Browser Challenge\",\"\u0080\":\"Control\u007f\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001F602\":\"Smiley\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+	},
+}
+
+// IEEE 754 samples from RFC 8785 appendix B
+var rfcNumberVectors = []struct {
+	bits     uint64
+	expected string
+}{
+	{0x0000000000000000, "0"},
+	{0x8000000000000000, "0"},
+	{0x0000000000000001, "5e-324"},
+	{0x8000000000000001, "-5e-324"},
+	{0x7fefffffffffffff, "1.7976931348623157e+308"},
+	{0xffefffffffffffff, "-1.7976931348623157e+308"},
+	{0x4340000000000000, "9007199254740992"},
+	{0xc340000000000000, "-9007199254740992"},
+	{0x4430000000000000, "295147905179352830000"},
+	{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+	{0x44b52d02c7e14af6, "1e+23"},
+	{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+	{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+	{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+	{0x444b1ae4d6e2ef50, "1e+21"},
+	{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+	{0x3eb0c6f7a0b5ed8d, "0.000001"},
+	{0x41b3de4355555553, "333333333.3333332"},
+	{0x41b3de4355555554, "333333333.33333325"},
+	{0x41b3de4355555555, "333333333.3333333"},
+	{0x41b3de4355555556, "333333333.3333334"},
+	{0x41b3de4355555557, "333333333.33333343"},
+	{0xbecbf647612f3696, "-0.0000033333333333333333"},
+	{0x43143ff3c1cb0959, "1424953923781206.2"},
+}
+
+func TestTransform_RFCTestVectors(t *testing.T) {
+	for _, vector := range rfcTestVectors {
+		t.Run(vector.name, func(t *testing.T) {
+			// Perform
+			canonical, err := Transform([]byte(vector.input))
+
+			// Check
+			assert.NoError(t, err)
+			assert.Equal(t, vector.expected, string(canonical))
+		})
+	}
+}
+
+func TestCanonicalize_RFCNumbers(t *testing.T) {
+	for _, vector := range rfcNumberVectors {
+		// Perform
+		canonical, err := Canonicalize(math.Float64frombits(vector.bits))
+
+		// Check
+		assert.NoError(t, err)
+		assert.Equal(t, vector.expected, string(canonical), "bits %016x", vector.bits)
+	}
+}
+
+func TestCanonicalize_InvalidNumbers(t *testing.T) {
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		// Perform
+		_, err := Canonicalize(value)
+
+		// Check
+		assert.Error(t, err)
+	}
+}
+
+func TestCanonicalize_MatchesDecodedPayload(t *testing.T) {
+	// Prepare: data as bound by the controllers
+	var data map[string]interface{}
+	err := json.Unmarshal([]byte(`{"b": "<&>", "a": [1, 2.50, {"z": true, "y": null}]}`), &data)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Perform
+	canonical, err := Canonicalize(data)
+
+	// Check: no HTML escaping, sorted keys, ECMAScript numbers
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":[1,2.5,{"y":null,"z":true}],"b":"<&>"}`, string(canonical))
+}
+
+func TestCanonicalize_UnsupportedType(t *testing.T) {
+	// Perform
+	_, err := Canonicalize(map[string]interface{}{"key1": func() {}})
+
+	// Check
+	assert.Error(t, err)
+}
+
+func TestTransform_InvalidJSON(t *testing.T) {
+	// Perform
+	_, err := Transform([]byte(`{"key1": value1"}`))
+
+	// Check
+	assert.Error(t, err)
+}
+
+func TestCanonicalizeExact_Numbers(t *testing.T) {
+	tests := map[string]string{
+		"9007199254740992":  "9007199254740992",
+		"-9007199254740991": "-9007199254740991",
+		"1.50":              "1.5",
+		"15e-1":             "1.5",
+		"0.1":               "0.1",
+		"1E30":              "1e+30",
+		"-0":                "0",
+		"0.000001":          "0.000001",
+	}
+
+	for number, expected := range tests {
+		// Perform
+		canonical, err := CanonicalizeExact(json.Number(number))
+
+		// Check
+		assert.NoError(t, err, number)
+		assert.Equal(t, expected, string(canonical), number)
+	}
+}
+
+func TestCanonicalizeExact_InexactNumbers(t *testing.T) {
+	for _, number := range []string{"9007199254740993", "333333333.33333329", "3.14159265358979323846", "1e-400", "1e400"} {
+		// Perform
+		_, err := CanonicalizeExact([]interface{}{json.Number(number)})
+
+		// Check
+		assert.Error(t, err, number)
+	}
+
+	// Check: Canonicalize keeps rounding them as RFC 8785 requires
+	canonical, err := Canonicalize(json.Number("9007199254740993"))
+	assert.NoError(t, err)
+	assert.Equal(t, "9007199254740992", string(canonical))
+
+	_, err = CanonicalizeExact(json.Number("9007199254740993"))
+	assert.ErrorIs(t, err, ErrInexactNumber)
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID of a request, taken from the client when valid or else generated,
+// and sent back on the response
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the context key of the request ID, set by AccessLog
+const RequestIDKey = "request_id"
+
+// problemCodeKey is the context key of the code of the problem a request was answered with
+const problemCodeKey = "problem_code"
+
+// RedactedValue replaces the value of redacted log attributes
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactedFields are the log attributes always redacted, whatever the configuration adds
+var DefaultRedactedFields = []string{
+	"authorization", "proxy-authorization", "cookie", "set-cookie", "x-api-key",
+	"data", "signature", "key", "token", "secret", "password",
+}
+
+// validRequestID restricts the request IDs taken from clients
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewLogHandler returns a handler writing JSON log records to w. The value of every attribute
+// named in DefaultRedactedFields or redact, ignoring case and in any group, is replaced with
+// RedactedValue, so no logger built on it can leak them. So is the value of every attribute of a
+// group with such a name.
+func NewLogHandler(w io.Writer, level slog.Leveler, redact []string) slog.Handler {
+	redacted := make(map[string]bool)
+	for _, fields := range [][]string{DefaultRedactedFields, redact} {
+		for _, field := range fields {
+			redacted[strings.ToLower(strings.TrimSpace(field))] = true
+		}
+	}
+
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		// Only called for the attributes within groups, which come with the names of their groups
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if redacted[strings.ToLower(attr.Key)] {
+				return slog.String(attr.Key, RedactedValue)
+			}
+			for _, group := range groups {
+				if redacted[strings.ToLower(group)] {
+					return slog.String(attr.Key, RedactedValue)
+				}
+			}
+			return attr
+		},
+	})
+}
+
+// AccessLog logs one record per request once it is answered: its ID, route, status, latency,
+// caller identity and sizes. Bodies are never read, only counted, and query parameters are logged
+// as attributes so the redaction of the handler applies to them.
+func AccessLog(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		body := &countingReader{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("request_id", requestID),
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("identity", Identity(c)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int64("request_bytes", body.n),
+			slog.Int("response_bytes", max(c.Writer.Size(), 0)),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if code := c.GetString(problemCodeKey); code != "" {
+			attrs = append(attrs, slog.String("code", code))
+		}
+		if query := c.Request.URL.Query(); len(query) > 0 {
+			params := make([]any, 0, len(query))
+			for name, values := range query {
+				params = append(params, slog.String(name, strings.Join(values, ",")))
+			}
+			attrs = append(attrs, slog.Group("query", params...))
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if status >= http.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"riot-api/tools"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setUpLoggedRouter returns a router logging its requests to the returned buffer.
+func setUpLoggedRouter() (*gin.Engine, *bytes.Buffer) {
+	logs := &bytes.Buffer{}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AccessLog(slog.New(NewLogHandler(logs, slog.LevelInfo, nil))))
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY"))), tools.NewBase64Encryptor())
+	router.POST("/encrypt", cryptoController.Encrypt)
+	router.POST("/sign", cryptoController.Sign)
+	router.POST("/verify", cryptoController.Verify)
+	return router, logs
+}
+
+// logRecords decodes the JSON log records, one per line.
+func logRecords(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAccessLog(t *testing.T) {
+	// Prepare
+	router, logs := setUpLoggedRouter()
+	body := `{"key1": "value1"}`
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/encrypt", strings.NewReader(body))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	records := logRecords(t, logs)
+	assert.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "request", record["msg"])
+	assert.Equal(t, w.Header().Get(RequestIDHeader), record["request_id"])
+	assert.Len(t, record["request_id"], 32)
+	assert.Equal(t, http.MethodPost, record["method"])
+	assert.Equal(t, "/encrypt", record["route"])
+	assert.Equal(t, float64(http.StatusOK), record["status"])
+	assert.Equal(t, float64(len(body)), record["request_bytes"])
+	assert.Equal(t, float64(w.Body.Len()), record["response_bytes"])
+	assert.Contains(t, record, "latency_ms")
+	assert.Contains(t, record, "identity")
+	assert.NotContains(t, record, "code")
+}
+
+func TestAccessLog_Problem(t *testing.T) {
+	// Prepare
+	router, logs := setUpLoggedRouter()
+
+	// Perform
+	performRequest(router, http.MethodPost, "/encrypt", strings.NewReader(InvalidJsonPayload))
+
+	// Check
+	record := logRecords(t, logs)[0]
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, float64(http.StatusBadRequest), record["status"])
+	assert.Equal(t, CodeInvalidJSON, record["code"])
+	assert.NotContains(t, logs.String(), "value1")
+}
+
+func TestAccessLog_RequestID(t *testing.T) {
+	// Prepare
+	router, logs := setUpLoggedRouter()
+
+	for id, kept := range map[string]bool{
+		"client-id.42":                    true,
+		"invalid id":                      false,
+		strings.Repeat("a", 129):          false,
+		`injected","level":"ERROR","x":"`: false,
+	} {
+		logs.Reset()
+		req, _ := http.NewRequest(http.MethodPost, "/sign", strings.NewReader(`{}`))
+		req.Header.Set(RequestIDHeader, id)
+
+		// Perform
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		// Check
+		record := logRecords(t, logs)[0]
+		assert.Equal(t, w.Header().Get(RequestIDHeader), record["request_id"], id)
+		assert.Equal(t, kept, id == record["request_id"], id)
+	}
+}
+
+func TestAccessLog_NoSensitiveValues(t *testing.T) {
+	// Prepare
+	router, logs := setUpLoggedRouter()
+	plaintext := "4111-1111-1111-1111"
+
+	// Perform
+	encrypted := performRequest(router, http.MethodPost, "/encrypt", strings.NewReader(`{"card": "`+plaintext+`"}`))
+	signed := performRequest(router, http.MethodPost, "/sign", strings.NewReader(`{"card": "`+plaintext+`"}`))
+	var signature struct {
+		Signature string `json:"signature"`
+	}
+	json.Unmarshal(signed.Body.Bytes(), &signature)
+
+	verify := `{"data": {"card": "` + plaintext + `"}, "signature": "` + signature.Signature + `"}`
+	req, _ := http.NewRequest(http.MethodPost, "/verify?signature="+url.QueryEscape(signature.Signature)+"&mode=strict", strings.NewReader(verify))
+	req.Header.Set("Authorization", "Bearer secret-api-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Check
+	var ciphertext map[string]string
+	json.Unmarshal(encrypted.Body.Bytes(), &ciphertext)
+	assert.NotEmpty(t, signature.Signature)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Len(t, logRecords(t, logs), 3)
+	for _, secret := range []string{plaintext, ciphertext["card"], signature.Signature, "secret-api-key"} {
+		assert.NotContains(t, logs.String(), secret)
+	}
+	record := logRecords(t, logs)[2]
+	assert.Equal(t, map[string]interface{}{"signature": RedactedValue, "mode": "strict"}, record["query"])
+}
+
+func TestNewLogHandler_Redact(t *testing.T) {
+	// Prepare
+	logs := &bytes.Buffer{}
+	logger := slog.New(NewLogHandler(logs, slog.LevelInfo, []string{" SSN "}))
+
+	// Perform
+	logger.Info("event", "ssn", "123-45-6789", slog.Group("user", "Authorization", "Bearer key", "name", "Ann"))
+
+	// Check
+	record := logRecords(t, logs)[0]
+	assert.Equal(t, RedactedValue, record["ssn"])
+	assert.Equal(t, map[string]interface{}{"Authorization": RedactedValue, "name": "Ann"}, record["user"])
+	assert.NotContains(t, logs.String(), "123-45-6789")
+}
+
+func TestNewLogHandler_RedactGroup(t *testing.T) {
+	// Prepare
+	logs := &bytes.Buffer{}
+	logger := slog.New(NewLogHandler(logs, slog.LevelInfo, []string{"card"}))
+
+	// Perform
+	logger.Info("event", slog.Group("Card", "pan", "4111111111111111", slog.Group("expiry", "month", 12)), "name", "Ann")
+	logger.WithGroup("data").Info("event", "pan", "4111111111111111")
+
+	// Check: nested groups included, whether given as attributes or to WithGroup
+	records := logRecords(t, logs)
+	assert.Equal(t, map[string]interface{}{"pan": RedactedValue, "expiry": map[string]interface{}{"month": RedactedValue}}, records[0]["Card"])
+	assert.Equal(t, "Ann", records[0]["name"])
+	assert.Equal(t, map[string]interface{}{"pan": RedactedValue}, records[1]["data"])
+	assert.NotContains(t, logs.String(), "4111111111111111")
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"riot-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBatchSize is the largest number of items a batch request may contain
+const MaxBatchSize = 1000
+
+// BatchResult defines the outcome of one item of a batch request.
+// @Description Index is the position of the item in the request. A successful item has data, a failed one has error, the controller.Problem the single-item endpoint would respond with
+type BatchResult struct {
+	Index int         `json:"index"`
+	Data  interface{} `json:"data,omitempty"`
+	Error *Problem    `json:"error,omitempty"`
+}
+
+// BatchResponse defines the body returned by the batch endpoints.
+// @Description Results are in the order of the request items
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// WithBatchWorkers sets how many items of a batch request are processed concurrently.
+func WithBatchWorkers(workers int) Option {
+	return func(cc *CryptoController) {
+		cc.batchWorkers = workers
+	}
+}
+
+// BatchEncrypt godoc
+// @Summary Encrypts each item of a batch
+// @Description Encrypts every item of the array as /encrypt would, with the same options applied to each. Items are processed concurrently and a failed item does not fail the others.
+// @Tags Batch
+// @Accept  json
+// @Produce  json
+// @Produce  application/problem+json
+// @Param items body []interface{} true "Documents to encrypt"
+// @Param X-Encryption-Context header string false "Context bound to the ciphertexts of every item"
+// @Param select query []string false "JSONPath or JSON Pointer of the values to encrypt in each item" collectionFormat(multi)
+// @Param depth query int false "Encrypt the values found at this depth in each item" minimum(1) maximum(32)
+// @Param envelope query bool false "Encrypt each item under its own data key"
+// @Param deterministic query []string false "JSONPath or JSON Pointer of the values to encrypt deterministically with AES-SIV" collectionFormat(multi)
+// @Success 200 {object} controller.BatchResponse "Encrypted items"
+// @Failure 400 {object} controller.Problem "invalid_json, invalid_options, batch_too_large or envelope_not_configured"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
+// @Router /batch/encrypt [post]
+func (cc *CryptoController) BatchEncrypt(c *gin.Context) {
+	items, ok := bindBatch(c)
+	if !ok {
+		return
+	}
+
+	options, err := encryptOptions(c)
+	if err != nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidOptions, err.Error()))
+		return
+	}
+
+	keys := cc.keys.Load()
+	envelope, ok := keys.envelopeRequested(c)
+	if !ok {
+		return
+	}
+
+	cc.processBatch(c, items, func(item json.RawMessage) (interface{}, error) {
+		var payload interface{}
+		if err := decodeJSON(bytes.NewReader(item), &payload); err != nil || payload == nil {
+			return nil, errInvalidJSON
+		}
+		return keys.encrypt(payload, options, envelope)
+	}, CodeEncryptFailed)
+}
+
+// BatchDecrypt godoc
+// @Summary Decrypts each item of a batch
+// @Description Decrypts every item of the array as /decrypt would, with the same options and mode applied to each. Items are processed concurrently and a failed item does not fail the others.
+// @Tags Batch
+// @Accept  json
+// @Produce  json
+// @Produce  application/problem+json
+// @Param items body []interface{} true "Documents to decrypt"
+// @Param X-Encryption-Context header string false "Context the values of every item were encrypted with"
+// @Param mode query string false "Decryption mode, defaults to the server setting" Enums(strict, passthrough)
+// @Param select query []string false "JSONPath or JSON Pointer of the values to decrypt in each item" collectionFormat(multi)
+// @Param depth query int false "Decrypt the values found at this depth in each item" minimum(1) maximum(32)
+// @Param deterministic query []string false "JSONPath or JSON Pointer of the deterministically encrypted values" collectionFormat(multi)
+// @Param envelope query bool false "Each item is a controller.WrappedPayload"
+// @Success 200 {object} controller.BatchResponse "Decrypted items"
+// @Failure 400 {object} controller.Problem "invalid_json, invalid_mode, invalid_options, batch_too_large or envelope_not_configured"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
+// @Router /batch/decrypt [post]
+func (cc *CryptoController) BatchDecrypt(c *gin.Context) {
+	items, ok := bindBatch(c)
+	if !ok {
+		return
+	}
+
+	options, err := encryptOptions(c)
+	if err != nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidOptions, err.Error()))
+		return
+	}
+
+	keys := cc.keys.Load()
+	envelope, ok := keys.envelopeRequested(c)
+	if !ok {
+		return
+	}
+
+	mode := c.DefaultQuery("mode", cc.decryptMode)
+	if mode != service.DecryptModeStrict && mode != service.DecryptModePassthrough {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidMode, "mode must be strict or passthrough"))
+		return
+	}
+
+	cc.processBatch(c, items, func(item json.RawMessage) (interface{}, error) {
+		var payload interface{}
+		if err := decodeJSON(bytes.NewReader(item), &payload); err != nil || payload == nil {
+			return nil, errInvalidJSON
+		}
+		return keys.decrypt(payload, options, envelope, mode)
+	}, CodeDecryptFailed)
+}
+
+// BatchSign godoc
+// @Summary Signs each item of a batch
+// @Description Signs every item of the array as /sign would. Items are processed concurrently and a failed item does not fail the others.
+// @Tags Batch
+// @Accept  json
+// @Produce  json
+// @Produce  application/problem+json
+// @Param items body []interface{} true "Documents to sign"
+// @Success 200 {object} controller.BatchResponse "Signatures, as {\"signature\": ...} objects"
+// @Failure 400 {object} controller.Problem "invalid_json or batch_too_large"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
+// @Router /batch/sign [post]
+func (cc *CryptoController) BatchSign(c *gin.Context) {
+	items, ok := bindBatch(c)
+	if !ok {
+		return
+	}
+
+	signer := cc.keys.Load().signer
+	cc.processBatch(c, items, func(item json.RawMessage) (interface{}, error) {
+		var payload interface{}
+		if err := decodeJSON(bytes.NewReader(item), &payload); err != nil || payload == nil {
+			return nil, errInvalidJSON
+		}
+
+		signature, err := service.SignPayload(signer, payload)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"signature": signature}, nil
+	}, CodeSignFailed)
+}
+
+// BatchVerify godoc
+// @Summary Verifies each item of a batch
+// @Description Verifies the signature of every item of the array as /verify would. A valid signature gives {"valid": true}, a rejected one gives the controller.Problem returned by /verify.
+// @Tags Batch
+// @Accept  json
+// @Produce  json
+// @Produce  application/problem+json
+// @Param items body []controller.VerifyRequest true "Signature verification requests"
+// @Success 200 {object} controller.BatchResponse "Verification results"
+// @Failure 400 {object} controller.Problem "invalid_json or batch_too_large"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
+// @Router /batch/verify [post]
+func (cc *CryptoController) BatchVerify(c *gin.Context) {
+	items, ok := bindBatch(c)
+	if !ok {
+		return
+	}
+
+	signer := cc.keys.Load().signer
+	cc.processBatch(c, items, func(item json.RawMessage) (interface{}, error) {
+		var request VerifyRequest
+		if err := decodeJSON(bytes.NewReader(item), &request); err != nil || request.Data == nil {
+			return nil, errInvalidJSON
+		}
+		return service.VerifySignature(signer, request.Data, request.Signature), nil
+	}, CodeInternalError)
+}
+
+// bindBatch reads the items of a batch request, responding with an error when the body is not a
+// JSON array or has too many items.
+func bindBatch(c *gin.Context) ([]json.RawMessage, bool) {
+	var items []json.RawMessage
+	if err := bindJSON(c, &items); err != nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidJSON, ""))
+		return nil, false
+	}
+	if len(items) > MaxBatchSize {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeBatchTooLarge, fmt.Sprintf("The maximum is %d items", MaxBatchSize)))
+		return nil, false
+	}
+	return items, true
+}
+
+// processBatch processes the items on the worker pool and responds with their results. Items
+// that fail for a reason the client did not cause get the code of the failing operation.
+func (cc *CryptoController) processBatch(c *gin.Context, items []json.RawMessage, process func(item json.RawMessage) (interface{}, error), code string) {
+	results := service.ProcessBatch(len(items), cc.batchWorkers, func(index int) (interface{}, error) {
+		return process(items[index])
+	})
+
+	response := BatchResponse{Results: make([]BatchResult, len(results))}
+	for index, result := range results {
+		response.Results[index] = batchResult(index, result, code)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func batchResult(index int, result service.BatchResult, code string) BatchResult {
+	if result.Err != nil {
+		problem := problemFor(result.Err, code)
+		return BatchResult{Index: index, Error: &problem}
+	}
+
+	if verification, ok := result.Value.(service.VerificationResult); ok {
+		if verification.Valid {
+			return BatchResult{Index: index, Data: gin.H{"valid": true}}
+		}
+		problem := verificationProblem(verification)
+		return BatchResult{Index: index, Error: &problem}
+	}
+	return BatchResult{Index: index, Data: result.Value}
+}
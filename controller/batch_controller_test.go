@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"riot-api/tools"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUpBatchRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signer := tools.NewHMACSigner([]byte(SigningKeyTest))
+	encryptor := tools.NewBase64Encryptor()
+	cryptoController := NewCryptoController(signer, encryptor, WithBatchWorkers(2))
+	router.POST("/batch/encrypt", cryptoController.BatchEncrypt)
+	router.POST("/batch/decrypt", cryptoController.BatchDecrypt)
+	router.POST("/batch/sign", cryptoController.BatchSign)
+	router.POST("/batch/verify", cryptoController.BatchVerify)
+	return router
+}
+
+func decodeBatchResponse(t *testing.T, body []byte) BatchResponse {
+	var response BatchResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("expected a batch response, but got %s", body)
+	}
+	return response
+}
+
+func TestBatchEncrypt(t *testing.T) {
+	// Prepare
+	router := setUpBatchRouter()
+	body := `[{"key1": "value1"}, null, {"key1": "value1"}]`
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/batch/encrypt", bytes.NewBufferString(body))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	response := decodeBatchResponse(t, w.Body.Bytes())
+	assert.Len(t, response.Results, 3)
+	for index, result := range response.Results {
+		assert.Equal(t, index, result.Index)
+	}
+	assert.Equal(t, EncryptedValidJsonPayload, response.Results[0].Data)
+	assert.Equal(t, CodeInvalidJSON, response.Results[1].Error.Code)
+	assert.Nil(t, response.Results[1].Data)
+	assert.Equal(t, EncryptedValidJsonPayload, response.Results[2].Data)
+}
+
+func TestBatchDecrypt(t *testing.T) {
+	// Prepare
+	router := setUpBatchRouter()
+	body := `[{"key1": "riot:v1:base64::InZhbHVlMSI="}, {"key1": "plain"}]`
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/batch/decrypt", bytes.NewBufferString(body))
+	passthrough := performRequest(router, http.MethodPost, "/batch/decrypt?mode=passthrough", bytes.NewBufferString(body))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	response := decodeBatchResponse(t, w.Body.Bytes())
+	assert.Equal(t, ValidJsonPayload, response.Results[0].Data)
+	assert.Equal(t, CodeInvalidCiphertext, response.Results[1].Error.Code)
+	assert.Equal(t, http.StatusBadRequest, response.Results[1].Error.Status)
+
+	assert.Equal(t, http.StatusOK, passthrough.Code)
+	response = decodeBatchResponse(t, passthrough.Body.Bytes())
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"key1": "plain"}, "decrypted_keys": []interface{}{}}, response.Results[1].Data)
+}
+
+func TestBatchSignAndVerify(t *testing.T) {
+	// Prepare
+	router := setUpBatchRouter()
+	body := fmt.Sprintf(`[
+		{"signature": %q, "data": {"key1": "value1"}},
+		{"signature": %q, "data": {"key1": "tampered"}},
+		{"data": {"key1": "value1"}}
+	]`, SignatureValidJsonPayload, SignatureValidJsonPayload)
+
+	// Perform
+	signed := performRequest(router, http.MethodPost, "/batch/sign", bytes.NewBufferString(`[{"key1": "value1"}]`))
+	verified := performRequest(router, http.MethodPost, "/batch/verify", bytes.NewBufferString(body))
+
+	// Check
+	assert.Equal(t, http.StatusOK, signed.Code)
+	response := decodeBatchResponse(t, signed.Body.Bytes())
+	assert.Equal(t, map[string]interface{}{"signature": SignatureValidJsonPayload}, response.Results[0].Data)
+
+	assert.Equal(t, http.StatusOK, verified.Code)
+	response = decodeBatchResponse(t, verified.Body.Bytes())
+	assert.Equal(t, map[string]interface{}{"valid": true}, response.Results[0].Data)
+	assert.Equal(t, CodeSignatureMismatch, response.Results[1].Error.Code)
+	assert.Equal(t, CodeInvalidJSON, response.Results[2].Error.Code)
+}
+
+func TestBatch_RejectsInvalidBatches(t *testing.T) {
+	// Prepare
+	router := setUpBatchRouter()
+	tooLarge := "[" + strings.Repeat(`{"key1": "value1"},`, MaxBatchSize) + `{"key1": "value1"}]`
+
+	tests := map[string]string{
+		"object":    `{"key1": "value1"}`,
+		"invalid":   InvalidJsonPayload,
+		"too large": tooLarge,
+	}
+
+	for name, body := range tests {
+		// Perform
+		w := performRequest(router, http.MethodPost, "/batch/encrypt", bytes.NewBufferString(body))
+
+		// Check
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+}
+
+func TestBatchEncrypt_Empty(t *testing.T) {
+	// Prepare
+	router := setUpBatchRouter()
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/batch/encrypt", bytes.NewBufferString(`[]`))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"results": []}`, w.Body.String())
+}
+
+func TestBatchDecrypt_PreservesNumbers(t *testing.T) {
+	// Prepare
+	router := setUpBatchRouter()
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/batch/decrypt?mode=passthrough", bytes.NewBufferString(`[{"id": 9007199254740993}]`))
+
+	// Check
+	assert.Contains(t, w.Body.String(), `"data":{"id":9007199254740993}`)
+}
@@ -1,109 +1,432 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"riot-api/service"
+	"runtime"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// EncryptionContextHeader carries an optional context, such as a tenant or record ID, that
+// authenticated encryption binds to every ciphertext along with its field name
+const EncryptionContextHeader = "X-Encryption-Context"
+
 // VerifyRequest defines the struct for the signature verification request.
 // @Description This is used for the request body of /verify
 type VerifyRequest struct {
-	Signature string                 `json:"signature" binding:"required"`
-	Data      map[string]interface{} `json:"data" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+	// Data is the signed JSON document, an object, an array or a scalar other than null
+	Data interface{} `json:"data"`
+}
+
+// PublicKeyResponse defines the body returned by /public-key.
+// @Description PublicKey is the PEM encoded PKIX (SubjectPublicKeyInfo) public key of the active key, whose ID prefixes new signatures. Keys also lists the public keys of the retired keys, which still verify older signatures
+type PublicKeyResponse struct {
+	Algorithm string           `json:"algorithm"`
+	KeyID     string           `json:"key_id,omitempty"`
+	PublicKey string           `json:"public_key"`
+	Keys      []PublicKeyEntry `json:"keys"`
+}
+
+// PublicKeyEntry defines the public key of one signing key.
+type PublicKeyEntry struct {
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// DecryptResponse defines the body returned by /decrypt in passthrough mode.
+// @Description DecryptedKeys lists the keys whose values were decrypted, every other value is returned unchanged. It is empty for a scalar document, decrypted or not
+type DecryptResponse struct {
+	Data          interface{} `json:"data"`
+	DecryptedKeys []string    `json:"decrypted_keys"`
+}
+
+// WrappedPayload defines a payload encrypted under a data key, along with that key wrapped under
+// a master key.
+// @Description Returned by /encrypt?envelope=true and accepted by /decrypt?envelope=true and /rewrap
+type WrappedPayload struct {
+	WrappedKey string      `json:"wrapped_key" binding:"required"`
+	Data       interface{} `json:"data,omitempty"`
 }
 
 type CryptoController struct {
-	signer    service.Signer
-	encryptor service.Encryptor
+	keys         atomic.Pointer[cryptoKeys]
+	decryptMode  string
+	batchWorkers int
+}
+
+// cryptoKeys holds everything that depends on key material, swapped as a whole on reload so a
+// request is always served with one consistent set of keys
+type cryptoKeys struct {
+	signer     service.Signer
+	encryptor  service.Encryptor
+	keyWrapper service.KeyWrapper
+}
+
+// Option configures optional behaviour of the CryptoController
+type Option func(*CryptoController)
+
+// WithDecryptMode sets the mode used by /decrypt when the request does not choose one.
+func WithDecryptMode(mode string) Option {
+	return func(cc *CryptoController) {
+		cc.decryptMode = mode
+	}
+}
+
+// WithKeyWrapper enables envelope encryption with per-request data keys and the /rewrap endpoint.
+func WithKeyWrapper(keyWrapper service.KeyWrapper) Option {
+	return func(cc *CryptoController) {
+		keys := *cc.keys.Load()
+		keys.keyWrapper = keyWrapper
+		cc.keys.Store(&keys)
+	}
 }
 
-func NewCryptoController(signer service.Signer, encryptor service.Encryptor) *CryptoController {
-	return &CryptoController{
-		signer:    signer,
-		encryptor: encryptor,
+func NewCryptoController(signer service.Signer, encryptor service.Encryptor, options ...Option) *CryptoController {
+	cc := &CryptoController{decryptMode: service.DecryptModeStrict, batchWorkers: runtime.GOMAXPROCS(0)}
+	cc.keys.Store(&cryptoKeys{signer: signer, encryptor: encryptor})
+	for _, option := range options {
+		option(cc)
 	}
+	return cc
+}
+
+// Reload atomically replaces the signer, encryptor and key wrapper, which may be nil. Requests in
+// flight finish with the keys they started with.
+func (cc *CryptoController) Reload(signer service.Signer, encryptor service.Encryptor, keyWrapper service.KeyWrapper) {
+	cc.keys.Store(&cryptoKeys{signer: signer, encryptor: encryptor, keyWrapper: keyWrapper})
 }
 
 // Encrypt godoc
 // @Summary Encrypts the given data
-// @Description Encrypts the values of the object at a depth of 1 using Base64 encoding.
+// @Description Encrypts the values of the object at a depth of 1 using the configured algorithm (Base64 by default). The elements of an array are encrypted like the values of an object, and a scalar is encrypted as a whole.
+// @Description With select or depth, only the selected nested values are encrypted and the shape of the document is kept.
+// @Description Values selected by deterministic are encrypted with AES-SIV, which always gives the same ciphertext for the same value, field and context. This allows equality lookups on encrypted fields but reveals which values are equal: every other value keeps randomized encryption.
+// @Description With AES-256-GCM, ChaCha20-Poly1305 or XChaCha20-Poly1305 each ciphertext is authenticated along with its field name and the optional context, so it fails to decrypt if moved to another field or record.
+// @Description With Content-Type application/x-ndjson the body is read one JSON document per line and each result is streamed back as a line, or as a controller.NDJSONError when that line fails.
 // @Tags Encryption
 // @Accept  json
+// @Accept  application/x-ndjson
 // @Produce  json
-// @Param data body map[string]interface{} true "Data to encrypt"
-// @Success 200 {object} map[string]string "Encrypted data"
-// @Failure 400 {string} string "Invalid JSON"
-// @Failure 500 {string} string "Internal Server Error"
+// @Produce  application/problem+json
+// @Produce  application/x-ndjson
+// @Param data body interface{} true "JSON document to encrypt: an object, an array or a scalar"
+// @Param X-Encryption-Context header string false "Context bound to the ciphertexts, such as a tenant or record ID. Required again to decrypt them"
+// @Param select query []string false "JSONPath ($.user.ssn, $.cards[*].pan) or JSON Pointer (/user/ssn) of the values to encrypt, keeping the rest of the document readable" collectionFormat(multi)
+// @Param depth query int false "Encrypt the values found at this depth, and any scalar above it, instead of whole top-level values" minimum(1) maximum(32)
+// @Param envelope query bool false "Encrypt under a fresh data key, returned wrapped under the master key in a controller.WrappedPayload"
+// @Param deterministic query []string false "JSONPath or JSON Pointer of the values to encrypt deterministically with AES-SIV, such as $.email. Equal values in the same field and context get equal ciphertexts, so they can be looked up and joined on, but anyone reading the ciphertexts can tell which values are equal and how often each occurs. Only use it for fields that need equality lookups" collectionFormat(multi)
+// @Success 200 {object} interface{} "Encrypted data, wrapped in a controller.WrappedPayload with envelope=true"
+// @Failure 400 {object} controller.Problem "invalid_json, invalid_options, deterministic_not_configured or envelope_not_configured"
+// @Failure 500 {object} controller.Problem "encrypt_failed"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
 // @Router /encrypt [post]
 func (cc *CryptoController) Encrypt(c *gin.Context) {
-	var payload map[string]interface{}
+	options, err := encryptOptions(c)
+	if err != nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidOptions, err.Error()))
+		return
+	}
+
+	keys := cc.keys.Load()
+	envelope, ok := keys.envelopeRequested(c)
+	if !ok {
+		return
+	}
+
+	if c.ContentType() == NDJSONContentType {
+		streamNDJSON(c, func(payload interface{}) (interface{}, error) {
+			return keys.encrypt(payload, options, envelope)
+		}, CodeEncryptFailed)
+		return
+	}
 
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+	payload, ok := bindDocument(c)
+	if !ok {
 		return
 	}
 
-	encryptedData, err := service.EncryptPayload(cc.encryptor, payload)
+	result, err := keys.encrypt(payload, options, envelope)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProblem(c, problemFor(err, CodeEncryptFailed))
 		return
 	}
 
-	c.JSON(http.StatusOK, encryptedData)
+	c.JSON(http.StatusOK, result)
+}
+
+// encrypt encrypts one payload, under a fresh data key returned in a WrappedPayload when envelope
+// is set.
+func (keys *cryptoKeys) encrypt(payload interface{}, options service.EncryptOptions, envelope bool) (interface{}, error) {
+	if !envelope {
+		return service.EncryptPayload(keys.encryptor, payload, options)
+	}
+
+	encryptor, wrappedKey, err := keys.keyWrapper.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	encryptedData, err := service.EncryptPayload(encryptor, payload, options)
+	if err != nil {
+		return nil, err
+	}
+	return WrappedPayload{WrappedKey: wrappedKey, Data: encryptedData}, nil
 }
 
 // Decrypt godoc
 // @Summary Decrypts the given data
-// @Description Decrypts the Base64 encoded values in the object at depth 1.
+// @Description Decrypts the encrypted values in the object or array at depth 1, or the encrypted scalar, using the configured algorithm, or the values selected by select or depth.
+// @Description In strict mode every value must be a ciphertext. In passthrough mode values that are not recognised ciphertexts are returned unchanged, and the response lists the decrypted keys.
+// @Description With Content-Type application/x-ndjson the body is read one JSON document per line and each result is streamed back as a line, or as a controller.NDJSONError when that line fails.
 // @Tags Encryption
 // @Accept  json
+// @Accept  application/x-ndjson
 // @Produce  json
-// @Param data body map[string]interface{} true "Data to decrypt"
-// @Success 200 {object} map[string]interface{} "Decrypted data"
-// @Failure 400 {string} string "Invalid JSON"
-// @Failure 500 {string} string "Internal Server Error"
+// @Produce  application/problem+json
+// @Produce  application/x-ndjson
+// @Param data body interface{} true "JSON document to decrypt"
+// @Param X-Encryption-Context header string false "Context the values were encrypted with"
+// @Param mode query string false "Decryption mode, defaults to the server setting" Enums(strict, passthrough)
+// @Param select query []string false "JSONPath or JSON Pointer of the values to decrypt, as given to /encrypt" collectionFormat(multi)
+// @Param depth query int false "Decrypt the values found at this depth, as given to /encrypt" minimum(1) maximum(32)
+// @Param deterministic query []string false "JSONPath or JSON Pointer of the deterministically encrypted values, as given to /encrypt" collectionFormat(multi)
+// @Param envelope query bool false "The data is a controller.WrappedPayload returned by /encrypt?envelope=true"
+// @Success 200 {object} interface{} "Decrypted data, wrapped in a controller.DecryptResponse in passthrough mode"
+// @Failure 400 {object} controller.Problem "invalid_json, invalid_mode, invalid_options, envelope_not_configured, invalid_ciphertext, ciphertext_rejected or unknown_key with its key_id"
+// @Failure 500 {object} controller.Problem "decrypt_failed"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
 // @Router /decrypt [post]
 func (cc *CryptoController) Decrypt(c *gin.Context) {
-	var payload map[string]interface{}
+	options, err := encryptOptions(c)
+	if err != nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidOptions, err.Error()))
+		return
+	}
+
+	keys := cc.keys.Load()
+	envelope, ok := keys.envelopeRequested(c)
+	if !ok {
+		return
+	}
+
+	mode := c.DefaultQuery("mode", cc.decryptMode)
+	if mode != service.DecryptModeStrict && mode != service.DecryptModePassthrough {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidMode, "mode must be strict or passthrough"))
+		return
+	}
+
+	if c.ContentType() == NDJSONContentType {
+		streamNDJSON(c, func(payload interface{}) (interface{}, error) {
+			return keys.decrypt(payload, options, envelope, mode)
+		}, CodeDecryptFailed)
+		return
+	}
+
+	payload, ok := bindDocument(c)
+	if !ok {
+		return
+	}
+
+	result, err := keys.decrypt(payload, options, envelope, mode)
+	if err != nil {
+		respondProblem(c, problemFor(err, CodeDecryptFailed))
+		return
+	}
 
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+	c.JSON(http.StatusOK, result)
+}
+
+// decrypt decrypts one payload, which is a WrappedPayload when envelope is set. In passthrough
+// mode the result is a DecryptResponse.
+func (keys *cryptoKeys) decrypt(payload interface{}, options service.EncryptOptions, envelope bool, mode string) (interface{}, error) {
+	encryptor := keys.encryptor
+	if envelope {
+		wrapped, _ := payload.(map[string]interface{})
+		wrappedKey, wrappedKeyOk := wrapped["wrapped_key"].(string)
+		data := wrapped["data"]
+		if !wrappedKeyOk || data == nil {
+			return nil, errInvalidJSON
+		}
+
+		var err error
+		encryptor, err = keys.keyWrapper.OpenDataKey(wrappedKey)
+		if err != nil {
+			return nil, err
+		}
+		payload = data
+	}
+
+	if mode == service.DecryptModePassthrough {
+		decryptedData, decryptedKeys, err := service.DecryptRecognizedPayload(encryptor, payload, options)
+		if err != nil {
+			return nil, err
+		}
+		return DecryptResponse{Data: decryptedData, DecryptedKeys: decryptedKeys}, nil
+	}
+	return service.DecryptPayload(encryptor, payload, options)
+}
+
+// bindDocument reads a JSON document of any type but null, responding with an error when the body
+// is not one.
+func bindDocument(c *gin.Context) (interface{}, bool) {
+	var document interface{}
+	if err := bindJSON(c, &document); err != nil || document == nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidJSON, ""))
+		return nil, false
+	}
+	return document, true
+}
+
+// bindJSON is ShouldBindJSON keeping numbers as json.Number, so they are decrypted, signed and
+// returned exactly as the client wrote them.
+func bindJSON(c *gin.Context, v interface{}) error {
+	if c.Request.Body == nil {
+		return errors.New("missing request body")
+	}
+	return decodeJSON(c.Request.Body, v)
+}
+
+// decodeJSON decodes one JSON document keeping numbers as json.Number, and validates the binding
+// tags of v.
+func decodeJSON(r io.Reader, v interface{}) error {
+	if err := service.DecodeJSON(r, v); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(v)
+}
+
+// errInvalidJSON is returned when a payload is valid JSON but not shaped as the request requires
+var errInvalidJSON = errors.New("invalid JSON")
+
+// envelopeRequested reads the envelope query parameter, responding with an error when it is
+// invalid or envelope encryption is not configured.
+func (keys *cryptoKeys) envelopeRequested(c *gin.Context) (bool, bool) {
+	envelope, err := strconv.ParseBool(c.DefaultQuery("envelope", "false"))
+	if err != nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidOptions, "envelope must be true or false"))
+		return false, false
+	}
+	if envelope && keys.keyWrapper == nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeEnvelopeNotConfigured, ""))
+		return false, false
+	}
+	return envelope, true
+}
+
+// Rewrap godoc
+// @Summary Rewraps a data key under the active master key
+// @Description Unwraps the data key of a payload encrypted with /encrypt?envelope=true and wraps it again under the active master key, so retired master keys can be removed without re-encrypting any payload.
+// @Description The data, if given, is returned unchanged: nothing is decrypted and neither the data key nor any plaintext is returned.
+// @Tags Encryption
+// @Accept  json
+// @Produce  json
+// @Produce  application/problem+json
+// @Param request body controller.WrappedPayload true "Wrapped data key, with optional data"
+// @Success 200 {object} controller.WrappedPayload "Rewrapped data key"
+// @Failure 400 {object} controller.Problem "invalid_json, envelope_not_configured, invalid_ciphertext, ciphertext_rejected or unknown_key with its key_id"
+// @Failure 500 {object} controller.Problem "rewrap_failed"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
+// @Router /rewrap [post]
+func (cc *CryptoController) Rewrap(c *gin.Context) {
+	var request WrappedPayload
+
+	if err := bindJSON(c, &request); err != nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidJSON, ""))
+		return
+	}
+
+	keyWrapper := cc.keys.Load().keyWrapper
+	if keyWrapper == nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeEnvelopeNotConfigured, ""))
 		return
 	}
 
-	decryptedData, err := service.DecryptPayload(cc.encryptor, payload)
+	wrappedKey, err := keyWrapper.Rewrap(request.WrappedKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProblem(c, problemFor(err, CodeRewrapFailed))
 		return
 	}
 
-	c.JSON(http.StatusOK, decryptedData)
+	c.JSON(http.StatusOK, WrappedPayload{WrappedKey: wrappedKey, Data: request.Data})
+}
+
+// encryptOptions reads the context header and the select, depth and deterministic query parameters.
+func encryptOptions(c *gin.Context) (service.EncryptOptions, error) {
+	options := service.EncryptOptions{Context: c.GetHeader(EncryptionContextHeader)}
+
+	selectors, err := service.ParseSelectors(c.QueryArray("select"))
+	if err != nil {
+		return options, err
+	}
+	options.Selectors = selectors
+
+	options.Deterministic, err = service.ParseSelectors(c.QueryArray("deterministic"))
+	if err != nil {
+		return options, err
+	}
+
+	if depth, ok := c.GetQuery("depth"); ok {
+		options.Depth, err = strconv.Atoi(depth)
+		if err != nil || options.Depth < 1 || options.Depth > service.MaxDepth {
+			return options, fmt.Errorf("depth must be between 1 and %d", service.MaxDepth)
+		}
+	}
+
+	if len(options.Selectors) > 0 && options.Depth > 0 {
+		return options, errors.New("select and depth cannot be combined")
+	}
+	// Data keys only encrypt with AES-GCM, an invalid envelope is reported by envelopeRequested
+	if envelope, _ := strconv.ParseBool(c.Query("envelope")); envelope && len(options.Deterministic) > 0 {
+		return options, errors.New("deterministic and envelope cannot be combined")
+	}
+	return options, nil
 }
 
 // Sign godoc
 // @Summary Generates a cryptographic signature for the given data
-// @Description Computes an HMAC signature using the provided data and a secret key.
+// @Description Signs the RFC 8785 canonical form of the provided JSON document, which may be an object, an array or a scalar, with the configured SIGNING_ALGORITHM: hmac-sha256 (the default), ed25519, ecdsa-p256 or rsa-pss-sha256. The signature is prefixed with the ID of the signing key, when it has one.
 // @Tags Signing
 // @Accept  json
 // @Produce  json
-// @Param data body map[string]interface{} true "Data to sign"
+// @Produce  application/problem+json
+// @Param data body interface{} true "JSON document to sign: an object, an array or a scalar"
 // @Success 200 {object} map[string]string "Signature"
-// @Failure 400 {string} string "Invalid JSON"
-// @Failure 500 {string} string "Internal Server Error"
+// @Failure 400 {object} controller.Problem "invalid_json, or inexact_number for a number such as an integer above 2^53 that cannot be signed exactly"
+// @Failure 500 {object} controller.Problem "sign_failed"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
 // @Router /sign [post]
 func (cc *CryptoController) Sign(c *gin.Context) {
-	var payload map[string]interface{}
-
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+	payload, ok := bindDocument(c)
+	if !ok {
 		return
 	}
 
-	signature, err := service.SignPayload(cc.signer, payload)
+	signature, err := service.SignPayload(cc.keys.Load().signer, payload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProblem(c, problemFor(err, CodeSignFailed))
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"signature": signature})
@@ -111,27 +434,70 @@ func (cc *CryptoController) Sign(c *gin.Context) {
 
 // Verify godoc
 // @Summary Verifies the provided signature for the given data
-// @Description Verifies if the provided HMAC signature matches the computed signature for the data.
+// @Description Verifies the provided signature of the data with the configured SIGNING_ALGORITHM (hmac-sha256, ed25519, ecdsa-p256 or rsa-pss-sha256), using the key whose ID prefixes the signature.
 // @Tags Signing
 // @Accept  json
 // @Produce  json
+// @Produce  application/problem+json
 // @Param request body controller.VerifyRequest true "Signature verification request"
 // @Success 204 "Signature is valid"
-// @Failure 400 {string} string "Invalid JSON or Invalid signature"
+// @Failure 400 {object} controller.Problem "invalid_json, or signature_mismatch, malformed_signature, unknown_key or invalid_data with the key_id of the signature"
+// @Failure 401 {object} controller.Problem "unauthorized"
+// @Failure 403 {object} controller.Problem "insufficient_scope"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Security APIKey
 // @Router /verify [post]
 func (cc *CryptoController) Verify(c *gin.Context) {
 	var request VerifyRequest
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+	if err := bindJSON(c, &request); err != nil || request.Data == nil {
+		respondProblem(c, newProblem(http.StatusBadRequest, CodeInvalidJSON, ""))
 		return
 	}
 
-	verified := service.VerifySignature(cc.signer, request.Data, request.Signature)
+	result := service.VerifySignature(cc.keys.Load().signer, request.Data, request.Signature)
 
-	if verified {
+	if result.Valid {
 		c.Status(http.StatusNoContent)
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		respondProblem(c, verificationProblem(result))
+	}
+}
+
+// PublicKey godoc
+// @Summary Returns the public keys used to verify signatures
+// @Description Returns the public keys of the configured asymmetric signing algorithm (ed25519, ecdsa-p256 or rsa-pss-sha256), so third parties can verify signatures offline: the active key, and the retired keys that still verify older signatures. A signature is verified with the key whose ID prefixes it. Not available with HMAC signing.
+// @Tags Signing
+// @Produce  json
+// @Produce  application/problem+json
+// @Success 200 {object} controller.PublicKeyResponse "Public key"
+// @Failure 404 {object} controller.Problem "no_public_key with HMAC signing"
+// @Failure 500 {object} controller.Problem "internal_error"
+// @Failure 429 {object} controller.Problem "rate_limited"
+// @Header 429 {integer} Retry-After "Seconds to wait before retrying"
+// @Router /public-key [get]
+func (cc *CryptoController) PublicKey(c *gin.Context) {
+	exporter, ok := cc.keys.Load().signer.(service.PublicKeyExporter)
+	if !ok {
+		respondProblem(c, newProblem(http.StatusNotFound, CodeNoPublicKey, "HMAC signatures are verified with the secret signing key, which has no public key"))
+		return
+	}
+
+	publicKeys, err := exporter.PublicKeys()
+	if err != nil {
+		respondProblem(c, newProblem(http.StatusInternalServerError, CodeInternalError, ""))
+		return
+	}
+
+	keys := make([]PublicKeyEntry, 0, len(publicKeys))
+	for _, publicKey := range publicKeys {
+		keys = append(keys, PublicKeyEntry{KeyID: publicKey.KeyID, PublicKey: publicKey.PEM})
 	}
+	c.JSON(http.StatusOK, PublicKeyResponse{
+		Algorithm: exporter.Algorithm(),
+		KeyID:     keys[0].KeyID,
+		PublicKey: keys[0].PublicKey,
+		Keys:      keys,
+	})
 }
@@ -2,21 +2,27 @@ package controller
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"riot-api/service"
 	"riot-api/tools"
 	"testing"
 
-	"github.com/didip/tollbooth/v7"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 // Data
 var ValidJsonPayload = map[string]interface{}{"key1": "value1"}
-var EncryptedValidJsonPayload = map[string]interface{}{"key1": "InZhbHVlMSI="}
+var EncryptedValidJsonPayload = map[string]interface{}{"key1": "riot:v1:base64::InZhbHVlMSI="}
+var LegacyEncryptedValidJsonPayload = map[string]interface{}{"key1": "InZhbHVlMSI="}
 var SignatureValidJsonPayload = "cJPPgZbzRuRhQNR8loSgf1TEJgmIuk68yu1P+kWv1C4="
 var SigningKeyTest = "7b03af03735a58b17fa00804dbf683b64ab30f29d2684893fc33759ae19f02c4"
 
@@ -25,11 +31,11 @@ var InvalidEncryptedJsonPayload = "{\"key1\": InZhbHVlMSI=\"}"
 
 func setUpRouter() *gin.Engine {
 	// increase limiter to run tests
-	rateLimiter := tollbooth.NewLimiter(1000, nil)
+	rateLimit := service.RateLimit{Rate: 1000, Burst: 1000}
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	router.Use(Cors)
-	router.Use(RateLimiter(rateLimiter))
+	router.Use(Cors(DefaultCorsConfig))
+	router.Use(RateLimiter(tools.NewMemoryRateLimitStore(), service.RateLimitPolicy{Default: rateLimit}, false))
 	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
 	encryptor := tools.NewBase64Encryptor()
 	cryptoController := NewCryptoController(signer, encryptor)
@@ -37,9 +43,22 @@ func setUpRouter() *gin.Engine {
 	router.POST("/decrypt", cryptoController.Decrypt)
 	router.POST("/sign", cryptoController.Sign)
 	router.POST("/verify", cryptoController.Verify)
+	router.GET("/public-key", cryptoController.PublicKey)
 	return router
 }
 
+// newTestKeyring returns the keyring of the purpose read from variables, as at startup
+func newTestKeyring(t *testing.T, variables map[string]string, purpose string) *tools.Keyring {
+	provider := tools.NewEnvKeyProvider(func(name string) string { return variables[name] })
+	keyring, err := tools.NewKeyringFromProvider(provider, purpose, func(material []byte) ([]byte, error) {
+		return material, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return keyring
+}
+
 func TestMain(m *testing.M) {
 	// Before tests
 	os.Setenv("SIGNING_KEY", SigningKeyTest)
@@ -86,11 +105,12 @@ func TestEncrypt_InvalidJSON(t *testing.T) {
 
 	// Check
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(t, "Invalid JSON", response["error"])
+	assert.Equal(t, "invalid_json", response["code"])
+	assert.Equal(t, "Invalid JSON", response["title"])
 
 }
 
@@ -116,6 +136,131 @@ func TestDecrypt(t *testing.T) {
 	assert.Equal(t, ValidJsonPayload["key1"], response["key1"])
 }
 
+func TestDecrypt_LegacyValue(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	jsonValue, _ := json.Marshal(LegacyEncryptedValidJsonPayload)
+
+	req, _ := http.NewRequest(http.MethodPost, "/decrypt", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Perform
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, ValidJsonPayload["key1"], response["key1"])
+}
+
+func TestDecrypt_ForeignEnvelope(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	req, _ := http.NewRequest(http.MethodPost, "/decrypt", bytes.NewBuffer([]byte("{\"key1\": \"riot:v1:rot13::vainyvq\"}")))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Perform
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "invalid_ciphertext", response["code"])
+	assert.Equal(t, "A value is not a ciphertext this server can read", response["detail"])
+}
+
+func TestDecrypt_Passthrough(t *testing.T) {
+	// Prepare: a partly encrypted payload
+	router := setUpRouter()
+
+	payload := `{"key1": "riot:v1:base64::InZhbHVlMSI=", "key2": 123, "key3": "plain", "key4": {"nested": true}}`
+	req, _ := http.NewRequest(http.MethodPost, "/decrypt?mode=passthrough", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Perform
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response DecryptResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, []string{"key1"}, response.DecryptedKeys)
+	assert.Equal(t, map[string]interface{}{
+		"key1": "value1",
+		"key2": float64(123),
+		"key3": "plain",
+		"key4": map[string]interface{}{"nested": true},
+	}, response.Data)
+}
+
+func TestDecrypt_PassthroughScalar(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/decrypt?mode=passthrough", bytes.NewBufferString(`"riot:v1:base64::InZhbHVlMSI="`))
+
+	// Check: the root value has no key to report
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data": "value1", "decrypted_keys": []}`, w.Body.String())
+}
+
+func TestDecrypt_PassthroughDefaultMode(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
+	encryptor := tools.NewBase64Encryptor()
+	cryptoController := NewCryptoController(signer, encryptor, WithDecryptMode("passthrough"))
+	router.POST("/decrypt", cryptoController.Decrypt)
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/decrypt", bytes.NewBuffer([]byte(`{"key1": "plain"}`)))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response DecryptResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Empty(t, response.DecryptedKeys)
+	assert.Equal(t, map[string]interface{}{"key1": "plain"}, response.Data)
+
+	// Check: the request can still choose strict mode
+	w = performRequest(router, http.MethodPost, "/decrypt?mode=strict", bytes.NewBuffer([]byte(`{"key1": "plain"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDecrypt_InvalidMode(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	jsonValue, _ := json.Marshal(EncryptedValidJsonPayload)
+
+	req, _ := http.NewRequest(http.MethodPost, "/decrypt?mode=lenient", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Perform
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "invalid_mode", response["code"])
+}
+
 func TestDecrypt_InvalidJSON(t *testing.T) {
 	// Prepare
 	router := setUpRouter()
@@ -129,11 +274,12 @@ func TestDecrypt_InvalidJSON(t *testing.T) {
 
 	// Check
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(t, "Invalid JSON", response["error"])
+	assert.Equal(t, "invalid_json", response["code"])
+	assert.Equal(t, "Invalid JSON", response["title"])
 }
 
 func TestDecrypt_InvalidData(t *testing.T) {
@@ -148,8 +294,9 @@ func TestDecrypt_InvalidData(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	// Check
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"code":"invalid_ciphertext"`)
 
 }
 
@@ -188,11 +335,12 @@ func TestSign_InvalidJSON(t *testing.T) {
 
 	// Check
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(t, "Invalid JSON", response["error"])
+	assert.Equal(t, "invalid_json", response["code"])
+	assert.Equal(t, "Invalid JSON", response["title"])
 
 }
 
@@ -235,16 +383,16 @@ func TestVerify_InvalidSignature(t *testing.T) {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(t, "Invalid signature", response["error"])
+	assert.Equal(t, "malformed_signature", response["code"])
 }
 
-func TestVerify_InvalidJSON(t *testing.T) {
+func TestVerify_MismatchedSignature(t *testing.T) {
 	// Prepare
 	router := setUpRouter()
 
 	payload := map[string]interface{}{
-		"signature": "wrong-signature",
-		"data":      InvalidJsonPayload,
+		"signature": SignatureValidJsonPayload,
+		"data":      map[string]interface{}{"key1": "value2"},
 	}
 	jsonValue, _ := json.Marshal(payload)
 
@@ -258,5 +406,569 @@ func TestVerify_InvalidJSON(t *testing.T) {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(t, "Invalid JSON", response["error"])
+	assert.Equal(t, "signature_mismatch", response["code"])
+	assert.Equal(t, "Invalid signature", response["title"])
+}
+
+func TestVerify_InvalidJSON(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	payload := `{"signature": "wrong-signature", "data": ` + InvalidJsonPayload + `}`
+
+	req, _ := http.NewRequest(http.MethodPost, "/verify", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "invalid_json", response["code"])
+	assert.Equal(t, "Invalid JSON", response["title"])
+}
+
+func TestPublicKey_SymmetricSigner(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	req, _ := http.NewRequest(http.MethodGet, "/public-key", nil)
+
+	// Perform
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Check
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "no_public_key", response["code"])
+}
+
+func TestPublicKey_Ed25519Signer(t *testing.T) {
+	// Prepare
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer := tools.NewEd25519Signer(privateKey)
+	cryptoController := NewCryptoController(signer, tools.NewBase64Encryptor())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/public-key", cryptoController.PublicKey)
+	router.POST("/verify", cryptoController.Verify)
+
+	signature, _ := signer.Sign(ValidJsonPayload)
+
+	// Perform
+	w := performRequest(router, http.MethodGet, "/public-key", nil)
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response PublicKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "ed25519", response.Algorithm)
+
+	block, _ := pem.Decode([]byte(response.PublicKey))
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey.Public(), publicKey)
+
+	// Check: the signature is accepted by /verify
+	jsonValue, _ := json.Marshal(map[string]interface{}{"signature": signature, "data": ValidJsonPayload})
+	w = performRequest(router, http.MethodPost, "/verify", bytes.NewBuffer(jsonValue))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestPublicKey_KeyRotation(t *testing.T) {
+	// Prepare: sign with v1, then rotate to v2 and keep v1 as retired
+	_, keyV1, _ := ed25519.GenerateKey(rand.Reader)
+	_, keyV2, _ := ed25519.GenerateKey(rand.Reader)
+	oldKeyring, _ := tools.NewKeyring("v1", []byte(base64.StdEncoding.EncodeToString(keyV1.Seed())))
+	oldSigner, _ := tools.NewEd25519KeyringSigner(oldKeyring)
+	oldSignature, _ := oldSigner.Sign(ValidJsonPayload)
+
+	keyring := newTestKeyring(t, map[string]string{
+		"SIGNING_KEY":          base64.StdEncoding.EncodeToString(keyV2.Seed()),
+		"SIGNING_KEY_ID":       "v2",
+		"SIGNING_RETIRED_KEYS": "v1=" + base64.StdEncoding.EncodeToString(keyV1.Seed()),
+	}, service.PurposeSigning)
+	signer, _ := tools.NewEd25519KeyringSigner(keyring)
+	cryptoController := NewCryptoController(signer, tools.NewBase64Encryptor())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/public-key", cryptoController.PublicKey)
+	router.POST("/verify", cryptoController.Verify)
+	jsonValue, _ := json.Marshal(map[string]interface{}{"signature": oldSignature, "data": ValidJsonPayload})
+
+	// Perform
+	w := performRequest(router, http.MethodGet, "/public-key", nil)
+	wVerify := performRequest(router, http.MethodPost, "/verify", bytes.NewBuffer(jsonValue))
+
+	// Check: the active key is listed first, the retired key still verifies
+	var response PublicKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v2", response.KeyID)
+	assert.Len(t, response.Keys, 2)
+	assert.Equal(t, PublicKeyEntry{KeyID: "v2", PublicKey: response.PublicKey}, response.Keys[0])
+	assert.Equal(t, "v1", response.Keys[1].KeyID)
+
+	block, _ := pem.Decode([]byte(response.Keys[1].PublicKey))
+	publicKey, _ := x509.ParsePKIXPublicKey(block.Bytes)
+	assert.Equal(t, keyV1.Public(), publicKey)
+	assert.Equal(t, http.StatusNoContent, wVerify.Code)
+}
+
+func TestEncryptDecrypt_EncryptionContext(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
+	encryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	cryptoController := NewCryptoController(signer, encryptor)
+	router.POST("/encrypt", cryptoController.Encrypt)
+	router.POST("/decrypt", cryptoController.Decrypt)
+
+	req, _ := http.NewRequest(http.MethodPost, "/encrypt", bytes.NewBuffer([]byte(`{"ssn": "123-45-6789"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EncryptionContextHeader, "record-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	encrypted := w.Body.Bytes()
+
+	decrypt := func(context string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/decrypt", bytes.NewBuffer(encrypted))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EncryptionContextHeader, context)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Perform & Check: only the original context decrypts
+	w = decrypt("record-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "123-45-6789", response["ssn"])
+
+	w = decrypt("record-2")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"ciphertext_rejected"`)
+}
+
+func TestEncryptDecrypt_Selectors(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+	payload := `{"user": {"name": "Ann", "ssn": "123-45-6789"}, "cards": [{"pan": "4111", "exp": "12/30"}, {"pan": "5500", "exp": "01/31"}]}`
+	query := "?select=$.user.ssn&select=$.cards[*].pan"
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/encrypt"+query, bytes.NewBufferString(payload))
+
+	// Check: only the selected leaves are encrypted, the shape is kept
+	assert.Equal(t, http.StatusOK, w.Code)
+	var encrypted map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &encrypted)
+	user := encrypted["user"].(map[string]interface{})
+	assert.Equal(t, "Ann", user["name"])
+	assert.Equal(t, "riot:v1:base64::IjEyMy00NS02Nzg5Ig==", user["ssn"])
+	for _, card := range encrypted["cards"].([]interface{}) {
+		assert.Contains(t, card.(map[string]interface{})["pan"], "riot:v1:base64::")
+		assert.NotContains(t, card.(map[string]interface{})["exp"], "riot:")
+	}
+
+	// Perform: decrypt with the same selectors
+	w = performRequest(router, http.MethodPost, "/decrypt"+query, bytes.NewBuffer(w.Body.Bytes()))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, payload, w.Body.String())
+}
+
+func TestEncrypt_Depth(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/encrypt?depth=2", bytes.NewBufferString(`{"user": {"name": "Ann"}, "id": 7}`))
+
+	// Check: nested values are encrypted one by one, scalars above the depth as a whole
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user": {"name": "riot:v1:base64::IkFubiI="}, "id": "riot:v1:base64::Nw=="}`, w.Body.String())
+}
+
+func TestEncrypt_InvalidOptions(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	for _, query := range []string{"?select=user.ssn", "?select=$..ssn", "?depth=0", "?depth=33", "?depth=two", "?select=$.user&depth=2"} {
+		// Perform
+		w := performRequest(router, http.MethodPost, "/encrypt"+query, bytes.NewBufferString(`{"user": {"ssn": "1"}}`))
+
+		// Check
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Contains(t, w.Body.String(), "Invalid options", query)
+	}
+}
+
+func TestEncryptDecrypt_Deterministic(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
+	aesEncryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	sivEncryptor, _ := tools.NewAESSIVEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	cryptoController := NewCryptoController(signer, tools.NewDispatchingEncryptor(aesEncryptor, sivEncryptor))
+	router.POST("/encrypt", cryptoController.Encrypt)
+	router.POST("/decrypt", cryptoController.Decrypt)
+	payload := `{"user": {"email": "ann@example.com", "name": "Ann"}}`
+
+	// Perform
+	var responses [2]map[string]map[string]string
+	for i := range responses {
+		w := performRequest(router, http.MethodPost, "/encrypt?deterministic=$.user.email", bytes.NewBufferString(payload))
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &responses[i])
+	}
+
+	// Check: only the selected value is deterministic, the rest of its object is still encrypted
+	assert.Equal(t, responses[0]["user"]["email"], responses[1]["user"]["email"])
+	assert.Contains(t, responses[0]["user"]["email"], "riot:v1:aes-siv::")
+	assert.NotEqual(t, responses[0]["user"]["name"], responses[1]["user"]["name"])
+	assert.Contains(t, responses[0]["user"]["name"], "riot:v1:aes-256-gcm::")
+
+	encrypted, _ := json.Marshal(responses[0])
+	w := performRequest(router, http.MethodPost, "/decrypt?deterministic=$.user.email", bytes.NewBuffer(encrypted))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, payload, w.Body.String())
+}
+
+func TestEncrypt_DeterministicArrayElements(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
+	aesEncryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	sivEncryptor, _ := tools.NewAESSIVEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	cryptoController := NewCryptoController(signer, tools.NewDispatchingEncryptor(aesEncryptor, sivEncryptor))
+	router.POST("/encrypt", cryptoController.Encrypt)
+	payload := `{"users": [{"email": "ann@example.com"}, {"email": "ann@example.com"}], "email": "ann@example.com"}`
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/encrypt?deterministic=$.users[*].email&deterministic=$.email", bytes.NewBufferString(payload))
+	var response struct {
+		Users []map[string]string `json:"users"`
+		Email string              `json:"email"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	// Check: the same value at two indexes of an array has the same ciphertext
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, response.Users[0]["email"], "riot:v1:aes-siv::")
+	assert.Equal(t, response.Users[0]["email"], response.Users[1]["email"])
+	assert.NotEqual(t, response.Email, response.Users[0]["email"])
+}
+
+func TestEncrypt_DeterministicNotConfigured(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/encrypt?deterministic=$.email", bytes.NewBufferString(`{"email": "ann@example.com"}`))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Deterministic encryption is not configured")
+}
+
+func TestEncrypt_DeterministicEnvelope(t *testing.T) {
+	// Prepare: deterministic encryption is configured, but data keys only encrypt randomly
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
+	aesEncryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	sivEncryptor, _ := tools.NewAESSIVEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	keyring, _ := tools.NewKeyring("v1", []byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	keyWrapper, _ := tools.NewKeyWrapper(keyring)
+	cryptoController := NewCryptoController(signer, tools.NewDispatchingEncryptor(aesEncryptor, sivEncryptor), WithKeyWrapper(keyWrapper))
+	router.POST("/encrypt", cryptoController.Encrypt)
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/encrypt?envelope=true&deterministic=$.email", bytes.NewBufferString(`{"email": "ann@example.com"}`))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"invalid_options"`)
+	assert.Contains(t, w.Body.String(), "deterministic and envelope cannot be combined")
+}
+
+func TestEncryptDecrypt_Envelope(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
+	oldKeyring, _ := tools.NewKeyring("v1", []byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	oldKeyWrapper, _ := tools.NewKeyWrapper(oldKeyring)
+	keyring := newTestKeyring(t, map[string]string{
+		"ENCRYPTION_KEY":          "0123456789abcdef0123456789abcdef",
+		"ENCRYPTION_KEY_ID":       "v2",
+		"ENCRYPTION_RETIRED_KEYS": "v1=mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg",
+	}, service.PurposeEncryption)
+	keyWrapper, _ := tools.NewKeyWrapper(keyring)
+	oldController := NewCryptoController(signer, tools.NewBase64Encryptor(), WithKeyWrapper(oldKeyWrapper))
+	cryptoController := NewCryptoController(signer, tools.NewBase64Encryptor(), WithKeyWrapper(keyWrapper))
+	router.POST("/encrypt", oldController.Encrypt)
+	router.POST("/decrypt", cryptoController.Decrypt)
+	router.POST("/rewrap", cryptoController.Rewrap)
+
+	// Perform: encrypt under the v1 master key
+	w := performRequest(router, http.MethodPost, "/encrypt?envelope=true", bytes.NewBufferString(`{"ssn": "123-45-6789"}`))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	var encrypted WrappedPayload
+	json.Unmarshal(w.Body.Bytes(), &encrypted)
+	assert.Contains(t, encrypted.WrappedKey, "riot:v1:aes-256-gcm:v1:")
+	assert.Contains(t, encrypted.Data.(map[string]interface{})["ssn"], "riot:v1:aes-256-gcm::")
+
+	// Perform: rewrap under v2, which must not touch the data
+	body, _ := json.Marshal(encrypted)
+	w = performRequest(router, http.MethodPost, "/rewrap", bytes.NewBuffer(body))
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rewrapped WrappedPayload
+	json.Unmarshal(w.Body.Bytes(), &rewrapped)
+	assert.Contains(t, rewrapped.WrappedKey, "riot:v1:aes-256-gcm:v2:")
+	assert.Equal(t, encrypted.Data, rewrapped.Data)
+	assert.NotContains(t, w.Body.String(), "123-45-6789")
+
+	// Perform & Check: both wrapped keys decrypt the data
+	for _, payload := range []WrappedPayload{encrypted, rewrapped} {
+		body, _ := json.Marshal(payload)
+		w = performRequest(router, http.MethodPost, "/decrypt?envelope=true", bytes.NewBuffer(body))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"ssn": "123-45-6789"}`, w.Body.String())
+	}
+}
+
+func TestEncrypt_EnvelopeNotConfigured(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), tools.NewBase64Encryptor())
+	router.POST("/rewrap", cryptoController.Rewrap)
+
+	// Perform
+	wEncrypt := performRequest(router, http.MethodPost, "/encrypt?envelope=true", bytes.NewBufferString(`{"key1": "value1"}`))
+	wRewrap := performRequest(router, http.MethodPost, "/rewrap", bytes.NewBufferString(`{"wrapped_key": "riot:v1:aes-256-gcm::AAAA"}`))
+	wInvalid := performRequest(router, http.MethodPost, "/encrypt?envelope=maybe", bytes.NewBufferString(`{"key1": "value1"}`))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, wEncrypt.Code)
+	assert.Contains(t, wEncrypt.Body.String(), "Envelope encryption is not configured")
+	assert.Equal(t, http.StatusBadRequest, wRewrap.Code)
+	assert.Equal(t, http.StatusBadRequest, wInvalid.Code)
+}
+
+func TestRewrap_InvalidJSON(t *testing.T) {
+	// Prepare
+	router := gin.New()
+	keyring, _ := tools.NewKeyring("", []byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	keyWrapper, _ := tools.NewKeyWrapper(keyring)
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), tools.NewBase64Encryptor(), WithKeyWrapper(keyWrapper))
+	router.POST("/rewrap", cryptoController.Rewrap)
+
+	// Perform
+	wMissing := performRequest(router, http.MethodPost, "/rewrap", bytes.NewBufferString(`{"data": {}}`))
+	wInvalidKey := performRequest(router, http.MethodPost, "/rewrap", bytes.NewBufferString(`{"wrapped_key": "riot:v1:aes-256-gcm::AAAA"}`))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, wMissing.Code)
+	assert.Equal(t, http.StatusBadRequest, wInvalidKey.Code)
+	assert.Contains(t, wInvalidKey.Body.String(), `"code":"invalid_ciphertext"`)
+}
+
+func TestReload_SwapsKeys(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), tools.NewBase64Encryptor())
+	router.POST("/sign", cryptoController.Sign)
+	router.POST("/encrypt", cryptoController.Encrypt)
+	newKeyring, _ := tools.NewKeyring("v2", []byte("new signing key"))
+	aesEncryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+
+	// Perform: keep serving requests while the keys are swapped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			w := performRequest(router, http.MethodPost, "/sign", bytes.NewBufferString(`{"key1": "value1"}`))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	}()
+	cryptoController.Reload(tools.NewHMACKeyringSigner(newKeyring), aesEncryptor, nil)
+	<-done
+
+	// Check: new requests use the new keys
+	w := performRequest(router, http.MethodPost, "/sign", bytes.NewBufferString(`{"key1": "value1"}`))
+	var signature map[string]string
+	json.Unmarshal(w.Body.Bytes(), &signature)
+	assert.Contains(t, signature["signature"], "v2:")
+
+	w = performRequest(router, http.MethodPost, "/encrypt", bytes.NewBufferString(`{"key1": "value1"}`))
+	assert.Contains(t, w.Body.String(), "riot:v1:aes-256-gcm::")
+}
+
+func TestEncrypt_ArraysAndScalars(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	tests := map[string]string{
+		`["value1", {"key1": "value1"}]`: `["riot:v1:base64::InZhbHVlMSI=", "riot:v1:base64::eyJrZXkxIjoidmFsdWUxIn0="]`,
+		`"value1"`:                       `"riot:v1:base64::InZhbHVlMSI="`,
+		`123`:                            `"riot:v1:base64::MTIz"`,
+	}
+
+	for document, encrypted := range tests {
+		// Perform
+		wEncrypt := performRequest(router, http.MethodPost, "/encrypt", bytes.NewBufferString(document))
+		wDecrypt := performRequest(router, http.MethodPost, "/decrypt", bytes.NewBufferString(encrypted))
+
+		// Check
+		assert.Equal(t, http.StatusOK, wEncrypt.Code, document)
+		assert.JSONEq(t, encrypted, wEncrypt.Body.String(), document)
+		assert.Equal(t, http.StatusOK, wDecrypt.Code, document)
+		assert.JSONEq(t, document, wDecrypt.Body.String(), document)
+	}
+}
+
+func TestEncrypt_ArrayElementsAreBoundToTheirIndex(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	aesEncryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), aesEncryptor)
+	router.POST("/encrypt", cryptoController.Encrypt)
+	router.POST("/decrypt", cryptoController.Decrypt)
+
+	w := performRequest(router, http.MethodPost, "/encrypt", bytes.NewBufferString(`["value1", "value2"]`))
+	var encrypted []interface{}
+	json.Unmarshal(w.Body.Bytes(), &encrypted)
+	swapped, _ := json.Marshal([]interface{}{encrypted[1], encrypted[0]})
+
+	// Perform
+	wDecrypt := performRequest(router, http.MethodPost, "/decrypt", bytes.NewBuffer(swapped))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, wDecrypt.Code)
+	assert.Contains(t, wDecrypt.Body.String(), `"code":"ciphertext_rejected"`)
+}
+
+func TestEncrypt_FieldBindingIsUnambiguous(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	aesEncryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), aesEncryptor)
+	router.POST("/encrypt", cryptoController.Encrypt)
+	router.POST("/decrypt", cryptoController.Decrypt)
+
+	wNested := performRequest(router, http.MethodPost, "/encrypt?depth=2", bytes.NewBufferString(`{"a": {"b": "value1"}}`))
+	var nested map[string]map[string]string
+	json.Unmarshal(wNested.Body.Bytes(), &nested)
+	wArray := performRequest(router, http.MethodPost, "/encrypt", bytes.NewBufferString(`["value1"]`))
+	var array []string
+	json.Unmarshal(wArray.Body.Bytes(), &array)
+
+	// A top-level key spelling the pointer of a nested value, and an object key spelling an index
+	moved := map[string]string{
+		"nested value to key /a/b": `{"/a/b": "` + nested["a"]["b"] + `"}`,
+		"array index 0 to key 0":   `{"0": "` + array[0] + `"}`,
+	}
+
+	for name, body := range moved {
+		// Perform
+		w := performRequest(router, http.MethodPost, "/decrypt", bytes.NewBufferString(body))
+
+		// Check
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+		assert.Contains(t, w.Body.String(), `"code":"ciphertext_rejected"`, name)
+	}
+}
+
+func TestSignAndVerify_ArraysAndScalars(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	for _, document := range []string{`[{"event": 1}, {"event": 2}]`, `"value1"`, `false`} {
+		// Perform
+		wSign := performRequest(router, http.MethodPost, "/sign", bytes.NewBufferString(document))
+		var signature map[string]string
+		json.Unmarshal(wSign.Body.Bytes(), &signature)
+		wVerify := performRequest(router, http.MethodPost, "/verify", bytes.NewBufferString(`{"signature": "`+signature["signature"]+`", "data": `+document+`}`))
+
+		// Check
+		assert.Equal(t, http.StatusOK, wSign.Code, document)
+		assert.Equal(t, http.StatusNoContent, wVerify.Code, document)
+	}
+}
+
+func TestSignAndVerify_RejectNull(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	// Perform
+	wSign := performRequest(router, http.MethodPost, "/sign", bytes.NewBufferString(`null`))
+	wVerify := performRequest(router, http.MethodPost, "/verify", bytes.NewBufferString(`{"signature": "`+SignatureValidJsonPayload+`"}`))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, wSign.Code)
+	assert.Equal(t, http.StatusBadRequest, wVerify.Code)
+}
+
+func TestEncryptDecrypt_PreservesNumbers(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	aesEncryptor, _ := tools.NewAESEncryptor([]byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), aesEncryptor)
+	router.POST("/encrypt", cryptoController.Encrypt)
+	router.POST("/decrypt", cryptoController.Decrypt)
+	document := `{"id": 9007199254740993, "amount": 0.10000000000000000000001, "ids": [12345678901234567890], "plain": 1.50}`
+
+	// Perform
+	wEncrypt := performRequest(router, http.MethodPost, "/encrypt", bytes.NewBufferString(document))
+	wDecrypt := performRequest(router, http.MethodPost, "/decrypt", wEncrypt.Body)
+	wPassthrough := performRequest(router, http.MethodPost, "/decrypt?mode=passthrough", bytes.NewBufferString(document))
+
+	// Check: numbers come back exactly as written, not rounded through float64
+	assert.Equal(t, http.StatusOK, wDecrypt.Code)
+	assert.Contains(t, wDecrypt.Body.String(), `"id":9007199254740993`)
+	assert.Contains(t, wDecrypt.Body.String(), `"amount":0.10000000000000000000001`)
+	assert.Contains(t, wDecrypt.Body.String(), `"ids":[12345678901234567890]`)
+	assert.Contains(t, wDecrypt.Body.String(), `"plain":1.50`)
+	assert.Contains(t, wPassthrough.Body.String(), `"id":9007199254740993`)
+}
+
+func TestSign_InexactNumber(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	// Perform
+	wInexact := performRequest(router, http.MethodPost, "/sign", bytes.NewBufferString(`{"id": 9007199254740993}`))
+	wExact := performRequest(router, http.MethodPost, "/sign", bytes.NewBufferString(`{"id": 9007199254740992, "price": 10.50}`))
+	wNative := performRequest(router, http.MethodPost, "/sign", bytes.NewBufferString(`{"price": 10.5, "id": 9.007199254740992e15}`))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, wInexact.Code)
+	assert.Contains(t, wInexact.Body.String(), "exactly representable")
+	assert.Equal(t, http.StatusOK, wExact.Code)
+	assert.Equal(t, wNative.Body.String(), wExact.Body.String())
 }
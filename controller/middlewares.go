@@ -1,43 +1,292 @@
 package controller
 
 import (
+	"log"
 	"net/http"
+	"riot-api/service"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/didip/tollbooth/v7"
-	"github.com/didip/tollbooth/v7/limiter"
 	"github.com/gin-gonic/gin"
 )
 
-func Cors(c *gin.Context) {
+// CorsConfig is the cross-origin resource sharing policy of Cors.
+type CorsConfig struct {
+	// AllowedOrigins are exact origins, "https://app.example.com", origins with a wildcard
+	// subdomain, "https://*.example.com", or "*" for any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed, or "*" for any
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers browsers let scripts read
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response, unless zero
+	MaxAge time.Duration
+}
 
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Access-Control-Allow-Methods", "*")
-	c.Header("Access-Control-Allow-Headers", "*")
-	c.Header("Content-Type", "application/json")
+// DefaultCorsConfig lets scripts of any origin call the API, without credentials, and read the
+// rate limiting headers and the request ID.
+var DefaultCorsConfig = CorsConfig{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{http.MethodGet, http.MethodPost},
+	AllowedHeaders: []string{"*"},
+	ExposedHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", RequestIDHeader},
+}
 
-	if c.Request.Method != "OPTIONS" {
-		c.Next()
-	} else {
+// Cors applies the CORS policy. Preflight requests are answered here with 200 OK, or a cors_rejected problem
+// when their origin, method or headers are not allowed. Other requests from an origin that is not
+// allowed go through without CORS headers, so browsers do not let scripts read their response.
+func Cors(config CorsConfig) gin.HandlerFunc {
+	origins := newOriginMatcher(config.AllowedOrigins)
+	allowedMethods := make(map[string]bool)
+	for _, method := range config.AllowedMethods {
+		allowedMethods[strings.ToUpper(method)] = true
+	}
+	anyHeader := false
+	allowedHeaders := make(map[string]bool)
+	for _, header := range config.AllowedHeaders {
+		anyHeader = anyHeader || header == "*"
+		allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		requestedMethod := c.GetHeader("Access-Control-Request-Method")
+		preflight := c.Request.Method == http.MethodOptions && requestedMethod != ""
+		c.Writer.Header().Add("Vary", "Origin")
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !origins.allows(origin) {
+			if preflight {
+				respondProblem(c, newProblem(http.StatusForbidden, CodeCorsRejected, "The origin is not allowed"))
+			} else if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusOK)
+			} else {
+				c.Next()
+			}
+			return
+		}
+
+		// With credentials, browsers do not accept "*"
+		if origins.anyOrigin && !config.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(config.ExposedHeaders) > 0 {
+				c.Header("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+			}
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusOK)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !allowedMethods[strings.ToUpper(requestedMethod)] {
+			respondProblem(c, newProblem(http.StatusForbidden, CodeCorsRejected, "The method "+requestedMethod+" is not allowed"))
+			return
+		}
+		var requestedHeaders []string
+		for _, header := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+			if header = strings.TrimSpace(header); header == "" {
+				continue
+			}
+			if !anyHeader && !allowedHeaders[http.CanonicalHeaderKey(header)] {
+				respondProblem(c, newProblem(http.StatusForbidden, CodeCorsRejected, "The header "+header+" is not allowed"))
+				return
+			}
+			requestedHeaders = append(requestedHeaders, header)
+		}
+
+		c.Header("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+		// Echoing the requested headers also covers Authorization, which "*" never does
+		if len(requestedHeaders) > 0 {
+			c.Header("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+		}
+		if config.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+		}
 		c.AbortWithStatus(http.StatusOK)
 	}
 }
 
-func RateLimiter(limiter *limiter.Limiter) gin.HandlerFunc {
+// originMatcher tells whether an origin is allowed
+type originMatcher struct {
+	anyOrigin bool
+	exact     map[string]bool
+	// wildcards are the parts of the origins around their "*"
+	wildcards [][2]string
+}
+
+func newOriginMatcher(origins []string) *originMatcher {
+	m := &originMatcher{exact: make(map[string]bool)}
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			m.anyOrigin = true
+		} else if prefix, suffix, found := strings.Cut(origin, "*"); found {
+			m.wildcards = append(m.wildcards, [2]string{prefix, suffix})
+		} else {
+			m.exact[origin] = true
+		}
+	}
+	return m
+}
+
+func (m *originMatcher) allows(origin string) bool {
+	origin = strings.ToLower(origin)
+	if m.anyOrigin || m.exact[origin] {
+		return true
+	}
+	for _, wildcard := range m.wildcards {
+		prefix, suffix := wildcard[0], wildcard[1]
+		if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			// The wildcard stands for subdomains, never for a path or port
+			if subdomain := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(subdomain, "/:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RateLimiter limits each caller to the limit the policy chooses for its identity, or its client
+// IP when anonymous, and the route, with the budgets kept in the store. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, and Retry-After when rejected.
+// When the store fails, requests are let through if failOpen is set and rejected otherwise.
+func RateLimiter(store service.RateLimitStore, policy service.RateLimitPolicy, failOpen bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := Identity(c)
+		if identity == "" {
+			identity = "ip:" + c.ClientIP()
+		}
+		limit, ownBudget := policy.Limit(identity, c.FullPath())
+		// Routes without a limit of their own share the budget of the caller
+		key := identity
+		if ownBudget {
+			key = c.FullPath() + " " + identity
+		}
+
+		result, err := store.Take(c.Request.Context(), key, limit)
+		if err != nil {
+			log.Printf("Rate limiting failed: %v", err)
+			if failOpen {
+				c.Next()
+				return
+			}
+			respondProblem(c, newProblem(http.StatusServiceUnavailable, CodeRateLimitUnavailable, "Please try again later"))
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", headerSeconds(result.Reset))
+		if !result.Allowed {
+			c.Header("Retry-After", headerSeconds(result.RetryAfter))
+			respondProblem(c, newProblem(http.StatusTooManyRequests, CodeRateLimited, "Please try again later"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// headerSeconds formats a duration as whole seconds, rounded up so clients never retry too early.
+func headerSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// PrincipalKey is the context key of the service.Principal authenticated by Authenticate or
+// RequireScope
+const PrincipalKey = "principal"
+
+// Authenticate sets the principal of a valid API key sent as "Authorization: Bearer <key>" in the
+// context under PrincipalKey, so that middlewares running before RequireScope, like RateLimiter,
+// know the caller. Requests without a valid key are let through for RequireScope to reject.
+func Authenticate(store service.APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found {
+			if principal, err := store.Authenticate(strings.TrimSpace(key)); err == nil {
+				c.Set(PrincipalKey, principal)
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireScope authenticates the API key sent as "Authorization: Bearer <key>", unless
+// Authenticate already did, and only lets the request through when the key was granted the scope.
+// The principal of the key is set in the context under PrincipalKey.
+func RequireScope(store service.APIKeyStore, scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		value, authenticated := c.Get(PrincipalKey)
+		principal, _ := value.(service.Principal)
+		if !authenticated {
+			key, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !found {
+				c.Header("WWW-Authenticate", `Bearer realm="riot"`)
+				respondProblem(c, newProblem(http.StatusUnauthorized, CodeUnauthorized, "Send an API key in the Authorization header with the Bearer scheme"))
+				return
+			}
 
-		clientIP := c.ClientIP()
-		limiterKey := "IP-" + clientIP
+			var err error
+			principal, err = store.Authenticate(strings.TrimSpace(key))
+			if err != nil {
+				c.Header("WWW-Authenticate", `Bearer realm="riot", error="invalid_token"`)
+				respondProblem(c, newProblem(http.StatusUnauthorized, CodeUnauthorized, "The API key is not valid"))
+				return
+			}
+			c.Set(PrincipalKey, principal)
+		}
 
-		httpErr := tollbooth.LimitByKeys(limiter, []string{limiterKey})
-		if httpErr != nil {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Too Many Request, please try later",
-			})
-			c.Abort()
+		if !principal.HasScope(scope) {
+			c.Header("WWW-Authenticate", `Bearer realm="riot", error="insufficient_scope", scope="`+scope+`"`)
+			respondProblem(c, newProblem(http.StatusForbidden, CodeInsufficientScope, "The API key is not granted the "+scope+" scope"))
 			return
 		}
 
 		c.Next()
 	}
+}
+
+// ClientSubjectKey is the context key of the subject of the verified client certificate, set by
+// ClientCertificate
+const ClientSubjectKey = "client_subject"
+
+// ClientCertificate sets the subject of the client certificate, on connections where the TLS
+// configuration verified one, in the context under ClientSubjectKey.
+func ClientCertificate(c *gin.Context) {
+	if state := c.Request.TLS; state != nil && len(state.VerifiedChains) > 0 {
+		c.Set(ClientSubjectKey, state.VerifiedChains[0][0].Subject.String())
+	}
+	c.Next()
+}
+
+// Identity returns who the caller is: the name of its API key, "api-key:billing", or else the
+// subject of its client certificate, "cert:CN=billing,O=Riot". It is empty for anonymous callers.
+func Identity(c *gin.Context) string {
+	if value, ok := c.Get(PrincipalKey); ok {
+		return "api-key:" + value.(service.Principal).Name
+	}
+	if subject := c.GetString(ClientSubjectKey); subject != "" {
+		return "cert:" + subject
+	}
+	return ""
+}
 
+// Recover responds to a handler that panicked, used with gin.CustomRecovery.
+func Recover(c *gin.Context, _ interface{}) {
+	respondProblem(c, newProblem(http.StatusInternalServerError, CodeInternalError, ""))
 }
@@ -2,15 +2,26 @@ package controller
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"riot-api/service"
 	"riot-api/tools"
 	"testing"
+	"time"
 
-	"github.com/didip/tollbooth/v7"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,17 +38,131 @@ func TestOptionsRequest(t *testing.T) {
 
 	// Check
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Empty(t, w.Header().Get("Content-Type"))
 
 }
 
+// performCorsRequest sends a request from the origin, a preflight when requestedMethod is set.
+func performCorsRequest(r http.Handler, method, path, origin, requestedMethod, requestedHeaders string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if requestedMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", requestedMethod)
+	}
+	if requestedHeaders != "" {
+		req.Header.Set("Access-Control-Request-Headers", requestedHeaders)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCors_Preflight(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	// Perform
+	w := performCorsRequest(router, http.MethodOptions, "/encrypt", "https://app.example.com", http.MethodPost, "Content-Type, Authorization")
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	// Authorization is allowed by name, since browsers do not count it in "*"
+	assert.Equal(t, "Content-Type, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCors_Policy(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Cors(CorsConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{http.MethodPost},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	router.POST("/sign", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	tests := map[string]struct {
+		method           string
+		origin           string
+		requestedMethod  string
+		requestedHeaders string
+		status           int
+		allowOrigin      string
+	}{
+		"exact origin":          {http.MethodPost, "https://app.example.com", "", "", http.StatusNoContent, "https://app.example.com"},
+		"origin case":           {http.MethodPost, "https://APP.example.com", "", "", http.StatusNoContent, "https://APP.example.com"},
+		"subdomain":             {http.MethodPost, "https://a.b.example.org", "", "", http.StatusNoContent, "https://a.b.example.org"},
+		"bare domain":           {http.MethodPost, "https://example.org", "", "", http.StatusNoContent, ""},
+		"subdomain with a port": {http.MethodPost, "https://evil.com:1.example.org", "", "", http.StatusNoContent, ""},
+		"other scheme":          {http.MethodPost, "http://app.example.com", "", "", http.StatusNoContent, ""},
+		"no origin":             {http.MethodPost, "", "", "", http.StatusNoContent, ""},
+		"preflight":             {http.MethodOptions, "https://app.example.com", http.MethodPost, "authorization", http.StatusOK, "https://app.example.com"},
+		"preflight origin":      {http.MethodOptions, "https://other.com", http.MethodPost, "", http.StatusForbidden, ""},
+		"preflight method":      {http.MethodOptions, "https://app.example.com", http.MethodDelete, "", http.StatusForbidden, "https://app.example.com"},
+		"preflight header":      {http.MethodOptions, "https://app.example.com", http.MethodPost, "X-Other", http.StatusForbidden, "https://app.example.com"},
+	}
+
+	for name, test := range tests {
+		// Perform
+		w := performCorsRequest(router, test.method, "/sign", test.origin, test.requestedMethod, test.requestedHeaders)
+
+		// Check
+		assert.Equal(t, test.status, w.Code, name)
+		assert.Equal(t, test.allowOrigin, w.Header().Get("Access-Control-Allow-Origin"), name)
+		assert.Contains(t, w.Header().Values("Vary"), "Origin", name)
+		if test.allowOrigin != "" {
+			assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"), name)
+		}
+		if test.allowOrigin != "" && test.status == http.StatusNoContent {
+			assert.Equal(t, "Retry-After", w.Header().Get("Access-Control-Expose-Headers"), name)
+		}
+		if test.status == http.StatusOK {
+			assert.Equal(t, "POST", w.Header().Get("Access-Control-Allow-Methods"), name)
+			assert.Equal(t, "authorization", w.Header().Get("Access-Control-Allow-Headers"), name)
+			assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"), name)
+		}
+		if test.status == http.StatusForbidden {
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"), name)
+			assert.Contains(t, w.Body.String(), `"code":"cors_rejected"`, name)
+		}
+	}
+}
+
+func TestCors_ContentType(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Cors(DefaultCorsConfig))
+	router.GET("/swagger/index.html", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte("<html></html>"))
+	})
+
+	// Perform
+	w := performCorsRequest(router, http.MethodGet, "/swagger/index.html", "https://app.example.com", "", "")
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
 func TestRateLimiter(t *testing.T) {
 	// Prepare
-	rateLimiter := tollbooth.NewLimiter(1, nil)
+	rateLimit := service.RateLimit{Rate: 1, Burst: 1}
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	router.Use(Cors)
-	router.Use(RateLimiter(rateLimiter))
+	router.Use(Cors(DefaultCorsConfig))
+	router.Use(RateLimiter(tools.NewMemoryRateLimitStore(), service.RateLimitPolicy{Default: rateLimit}, false))
 	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
 	encryptor := tools.NewBase64Encryptor()
 	cryptoController := NewCryptoController(signer, encryptor)
@@ -47,10 +172,245 @@ func TestRateLimiter(t *testing.T) {
 	// should pass
 	w := performRequest(router, "POST", "/encrypt", bytes.NewBuffer([]byte("{\"key1\": \"value1\"}")))
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
 
 	// the second should fail
 	w = performRequest(router, "POST", "/encrypt", bytes.NewBuffer([]byte("{\"key1\": \"value1\"}")))
 	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"code":"rate_limited"`)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimiter_Redis(t *testing.T) {
+	// Prepare
+	server := miniredis.RunT(t)
+	gin.SetMode(gin.TestMode)
+	rateLimit := service.RateLimit{Rate: 1, Burst: 1}
+	// Two replicas sharing the same Redis
+	replicas := make([]*gin.Engine, 2)
+	for i := range replicas {
+		replicas[i] = gin.New()
+		replicas[i].Use(RateLimiter(tools.NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: server.Addr()})), service.RateLimitPolicy{Default: rateLimit}, false))
+		replicas[i].GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	}
+
+	// Perform
+	first := performRequest(replicas[0], http.MethodGet, "/", nil)
+	second := performRequest(replicas[1], http.MethodGet, "/", nil)
+
+	// Check
+	assert.Equal(t, http.StatusNoContent, first.Code)
+	assert.Equal(t, http.StatusTooManyRequests, second.Code)
+}
+
+func TestRateLimiter_StoreFailure(t *testing.T) {
+	// Prepare
+	server := miniredis.RunT(t)
+	store := tools.NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1}))
+	server.Close()
+
+	gin.SetMode(gin.TestMode)
+	rateLimit := service.RateLimit{Rate: 1, Burst: 1}
+	failOpen := gin.New()
+	failOpen.Use(RateLimiter(store, service.RateLimitPolicy{Default: rateLimit}, true))
+	failOpen.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	failClosed := gin.New()
+	failClosed.Use(RateLimiter(store, service.RateLimitPolicy{Default: rateLimit}, false))
+	failClosed.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	// Perform
+	open := performRequest(failOpen, http.MethodGet, "/", nil)
+	closed := performRequest(failClosed, http.MethodGet, "/", nil)
+
+	// Check
+	assert.Equal(t, http.StatusNoContent, open.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, closed.Code)
+	assert.Contains(t, closed.Body.String(), `"code":"rate_limit_unavailable"`)
+}
+
+func TestRateLimiter_Policy(t *testing.T) {
+	// Prepare
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	os.WriteFile(path, []byte(`{"keys": [{"name": "billing", "sha256": "`+tools.HashAPIKey("billing-key")+`", "scopes": ["decrypt"]}]}`), 0600)
+	apiKeys, err := tools.NewFileAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Slow enough that no budget refills during the test
+	policy := service.RateLimitPolicy{
+		Default: service.RateLimit{Rate: 0.001, Burst: 1},
+		Routes:  map[string]service.RateLimit{"/decrypt": {Rate: 0.001, Burst: 2}},
+		Identities: map[string]service.IdentityRateLimits{
+			"api-key:billing": {Default: &service.RateLimit{Rate: 0.001, Burst: 3}},
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Authenticate(apiKeys))
+	router.Use(RateLimiter(tools.NewMemoryRateLimitStore(), policy, false))
+	handler := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.POST("/sign", handler)
+	router.POST("/verify", handler)
+	router.POST("/decrypt", handler)
+
+	request := func(path, authorization string) int {
+		req, _ := http.NewRequest(http.MethodPost, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Perform
+	// Routes without a limit of their own share the budget of the client IP
+	anonymous := []int{request("/verify", ""), request("/sign", "")}
+	// Invalid keys are limited by client IP too
+	invalid := request("/verify", "Bearer other-key")
+	// The route has its own budget
+	decrypt := []int{request("/decrypt", ""), request("/decrypt", ""), request("/decrypt", "")}
+	// The API key has its own budget, apart from its client IP
+	billing := []int{request("/verify", "Bearer billing-key"), request("/sign", "Bearer billing-key"), request("/verify", "Bearer billing-key"), request("/verify", "Bearer billing-key")}
+
+	// Check
+	assert.Equal(t, []int{http.StatusNoContent, http.StatusTooManyRequests}, anonymous)
+	assert.Equal(t, http.StatusTooManyRequests, invalid)
+	assert.Equal(t, []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests}, decrypt)
+	assert.Equal(t, []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests}, billing)
+}
+
+func TestRequireScope(t *testing.T) {
+	// Prepare
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	os.WriteFile(path, []byte(`{"keys": [{"name": "frontend", "sha256": "`+tools.HashAPIKey("frontend-key")+`", "scopes": ["verify"]}]}`), 0600)
+	store, err := tools.NewFileAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var principal interface{}
+	handler := func(c *gin.Context) {
+		principal, _ = c.Get(PrincipalKey)
+		c.Status(http.StatusNoContent)
+	}
+	router.POST("/verify", RequireScope(store, service.ScopeVerify), handler)
+	router.POST("/sign", RequireScope(store, service.ScopeSign), handler)
+
+	tests := map[string]struct {
+		path          string
+		authorization string
+		status        int
+		code          string
+	}{
+		"granted":     {"/verify", "Bearer frontend-key", http.StatusNoContent, ""},
+		"missing":     {"/verify", "", http.StatusUnauthorized, CodeUnauthorized},
+		"not bearer":  {"/verify", "Basic ZnJvbnRlbmQ6a2V5", http.StatusUnauthorized, CodeUnauthorized},
+		"unknown":     {"/verify", "Bearer other-key", http.StatusUnauthorized, CodeUnauthorized},
+		"not granted": {"/sign", "Bearer frontend-key", http.StatusForbidden, CodeInsufficientScope},
+	}
+
+	for name, test := range tests {
+		// Perform
+		req, _ := http.NewRequest(http.MethodPost, test.path, nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		// Check
+		assert.Equal(t, test.status, w.Code, name)
+		if test.code != "" {
+			assert.Contains(t, w.Body.String(), `"code":"`+test.code+`"`, name)
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"), name)
+		}
+	}
+	assert.Equal(t, service.Principal{Name: "frontend", Scopes: []string{"verify"}}, principal)
+}
+
+// issueCertificate generates a certificate and its key in memory, signed by the issuer or
+// self-signed when the issuer is nil.
+func issueCertificate(t *testing.T, template *x509.Certificate, issuer *tls.Certificate) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parent, parentKey := template, interface{}(key)
+	if issuer != nil {
+		parent, parentKey = issuer.Leaf, issuer.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestClientCertificate(t *testing.T) {
+	// Prepare
+	clientCA := issueCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Client CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	clientCertificate := issueCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing", Organization: []string{"Riot"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &clientCA)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ClientCertificate)
+	router.GET("/identity", func(c *gin.Context) {
+		c.String(http.StatusOK, Identity(c))
+	})
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.Leaf)
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{clientCertificate}
+
+	// Perform
+	res, err := client.Get(server.URL + "/identity")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	defer res.Body.Close()
+	identity, _ := io.ReadAll(res.Body)
+	anonymous := performRequest(router, http.MethodGet, "/identity", nil)
+
+	// Check
+	assert.Equal(t, "cert:CN=billing,O=Riot", string(identity))
+	assert.Empty(t, anonymous.Body.String())
+}
+
+func TestIdentity_PrefersAPIKey(t *testing.T) {
+	// Prepare
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(ClientSubjectKey, "CN=billing")
+	c.Set(PrincipalKey, service.Principal{Name: "frontend"})
+
+	// Perform
+	identity := Identity(c)
+
+	// Check
+	assert.Equal(t, "api-key:frontend", identity)
 }
 
 func performRequest(r http.Handler, method, path string, body io.Reader) *httptest.ResponseRecorder {
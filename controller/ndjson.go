@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NDJSONContentType selects streaming, with one JSON object per line, on /encrypt and /decrypt
+const NDJSONContentType = "application/x-ndjson"
+
+// MaxNDJSONLineSize is the largest line accepted in an NDJSON stream
+const MaxNDJSONLineSize = 10 << 20
+
+// NDJSONError defines the line written in place of the result of a line that failed.
+// @Description Line is the 1-based number of the input line, the other fields are those of a controller.Problem
+type NDJSONError struct {
+	Line int `json:"line"`
+	Problem
+}
+
+// streamNDJSON processes the request body one JSON document per line and writes each result as a line,
+// flushed as soon as it is ready, so memory use does not depend on the size of the body. Blank
+// lines are skipped and a line that fails is answered with an NDJSONError, with the given code
+// when the client did not cause the failure.
+func streamNDJSON(c *gin.Context, process func(payload interface{}) (interface{}, error), code string) {
+	// HTTP/1.1 responses normally stop the request body from being read once they have started
+	_ = http.NewResponseController(c.Writer).EnableFullDuplex()
+
+	c.Header("Content-Type", NDJSONContentType)
+	c.Status(http.StatusOK)
+
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), MaxNDJSONLineSize)
+
+	line := 1
+	for ; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var result interface{}
+		var payload interface{}
+		if err := decodeJSON(bytes.NewReader(scanner.Bytes()), &payload); err != nil || payload == nil {
+			result = NDJSONError{Line: line, Problem: newProblem(http.StatusBadRequest, CodeInvalidJSON, "")}
+		} else if value, err := process(payload); err != nil {
+			result = NDJSONError{Line: line, Problem: problemFor(err, code)}
+		} else {
+			result = value
+		}
+
+		if !writeNDJSONLine(c, result) {
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		problem := newProblem(http.StatusBadRequest, CodeInvalidNDJSON, "The request body could not be read")
+		if errors.Is(err, bufio.ErrTooLong) {
+			problem = newProblem(http.StatusBadRequest, CodeLineTooLong, fmt.Sprintf("The maximum is %d bytes", MaxNDJSONLineSize))
+		}
+		writeNDJSONLine(c, NDJSONError{Line: line, Problem: problem})
+	}
+}
+
+// writeNDJSONLine writes and flushes one line, reporting false once the client is gone.
+func writeNDJSONLine(c *gin.Context, value interface{}) bool {
+	line, err := json.Marshal(value)
+	if err != nil {
+		line, _ = json.Marshal(newProblem(http.StatusInternalServerError, CodeInternalError, ""))
+	}
+
+	if _, err := c.Writer.Write(append(line, '\n')); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"riot-api/tools"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUpNDJSONRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), tools.NewBase64Encryptor())
+	router.POST("/encrypt", cryptoController.Encrypt)
+	router.POST("/decrypt", cryptoController.Decrypt)
+	return router
+}
+
+func performNDJSONRequest(r http.Handler, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", NDJSONContentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestEncrypt_NDJSON(t *testing.T) {
+	// Prepare
+	router := setUpNDJSONRouter()
+	body := "{\"key1\": \"value1\"}\n\n{bad\n{\"key1\": \"value1\"}"
+
+	// Perform
+	w := performNDJSONRequest(router, "/encrypt", body)
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, NDJSONContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"key1":"riot:v1:base64::InZhbHVlMSI="}
+{"line":3,"type":"urn:riot:problem:invalid_json","title":"Invalid JSON","status":400,"code":"invalid_json"}
+{"key1":"riot:v1:base64::InZhbHVlMSI="}
+`, w.Body.String())
+}
+
+func TestDecrypt_NDJSON(t *testing.T) {
+	// Prepare
+	router := setUpNDJSONRouter()
+	body := "{\"key1\": \"riot:v1:base64::InZhbHVlMSI=\"}\n{\"key1\": \"riot:v1:base64::!\"}\n"
+
+	// Perform
+	w := performNDJSONRequest(router, "/decrypt", body)
+
+	// Check
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `{"key1":"value1"}`, lines[0])
+	assert.Contains(t, lines[1], `"line":2`)
+}
+
+func TestEncrypt_NDJSONLineTooLong(t *testing.T) {
+	// Prepare
+	router := setUpNDJSONRouter()
+	body := "{\"key1\": \"value1\"}\n{\"key1\": \"" + strings.Repeat("a", MaxNDJSONLineSize) + "\"}\n"
+
+	// Perform
+	w := performNDJSONRequest(router, "/encrypt", body)
+
+	// Check
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"line":2,`)
+	assert.Contains(t, lines[1], `"code":"line_too_long"`)
+}
+
+func TestEncrypt_NDJSONUnreadableBody(t *testing.T) {
+	// Prepare: the body fails after its first line
+	router := setUpNDJSONRouter()
+	body := io.MultiReader(strings.NewReader("{\"key1\": \"value1\"}\n"), iotest.ErrReader(errors.New("connection reset by 10.0.0.1")))
+	req, _ := http.NewRequest(http.MethodPost, "/encrypt", body)
+	req.Header.Set("Content-Type", NDJSONContentType)
+	w := httptest.NewRecorder()
+
+	// Perform
+	router.ServeHTTP(w, req)
+
+	// Check: the read error is not sent back
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `{"line":2,"type":"urn:riot:problem:invalid_ndjson","title":"Invalid NDJSON","status":400,"detail":"The request body could not be read","code":"invalid_ndjson"}`, lines[1])
+}
+
+func TestEncrypt_NDJSONInvalidOptions(t *testing.T) {
+	// Prepare
+	router := setUpNDJSONRouter()
+
+	// Perform
+	w := performNDJSONRequest(router, "/encrypt?depth=0", "{\"key1\": \"value1\"}\n")
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestEncrypt_NDJSONStreams(t *testing.T) {
+	// Prepare
+	server := httptest.NewServer(setUpNDJSONRouter())
+	defer server.Close()
+
+	body, input := io.Pipe()
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/encrypt", body)
+	req.Header.Set("Content-Type", NDJSONContentType)
+
+	// Perform
+	responses := make(chan *http.Response)
+	go func() {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			close(responses)
+			return
+		}
+		responses <- res
+	}()
+	io.WriteString(input, "{\"key1\": \"value1\"}\n")
+	res, ok := <-responses
+	if !ok {
+		t.Fatalf("expected a response")
+	}
+	defer res.Body.Close()
+	output := bufio.NewReader(res.Body)
+
+	// Check: each result arrives before the next line is sent
+	first, _ := output.ReadString('\n')
+	assert.Equal(t, "{\"key1\":\"riot:v1:base64::InZhbHVlMSI=\"}\n", first)
+
+	io.WriteString(input, "{\"key2\": \"value1\"}\n")
+	second, _ := output.ReadString('\n')
+	assert.Equal(t, "{\"key2\":\"riot:v1:base64::InZhbHVlMSI=\"}\n", second)
+
+	input.Close()
+	_, err := output.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecrypt_NDJSONPreservesNumbers(t *testing.T) {
+	// Prepare
+	router := setUpNDJSONRouter()
+
+	// Perform
+	encrypted := performNDJSONRequest(router, "/encrypt", "{\"id\": 9007199254740993}\n")
+	w := performNDJSONRequest(router, "/decrypt", encrypted.Body.String())
+
+	// Check
+	assert.Equal(t, "{\"id\":9007199254740993}\n", w.Body.String())
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"riot-api/canonicalizer"
+	"riot-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of error responses, defined by RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix prefixes the code of a problem to form its type URI
+const ProblemTypePrefix = "urn:riot:problem:"
+
+// Stable, machine-readable problem codes. New codes may be added, existing ones are never renamed.
+const (
+	CodeInvalidJSON                = "invalid_json"
+	CodeInvalidOptions             = "invalid_options"
+	CodeInvalidMode                = "invalid_mode"
+	CodeBatchTooLarge              = "batch_too_large"
+	CodeLineTooLong                = "line_too_long"
+	CodeInvalidNDJSON              = "invalid_ndjson"
+	CodeEnvelopeNotConfigured      = "envelope_not_configured"
+	CodeDeterministicNotConfigured = "deterministic_not_configured"
+	CodeInexactNumber              = "inexact_number"
+	CodeEncryptFailed              = "encrypt_failed"
+	CodeDecryptFailed              = "decrypt_failed"
+	CodeRewrapFailed               = "rewrap_failed"
+	CodeUnknownKey                 = "unknown_key"
+	CodeInvalidCiphertext          = "invalid_ciphertext"
+	CodeCiphertextRejected         = "ciphertext_rejected"
+	CodeSignFailed                 = "sign_failed"
+	CodeSignatureMismatch          = "signature_mismatch"
+	CodeMalformedSignature         = "malformed_signature"
+	CodeInvalidData                = "invalid_data"
+	CodeNoPublicKey                = "no_public_key"
+	CodeUnauthorized               = "unauthorized"
+	CodeInsufficientScope          = "insufficient_scope"
+	CodeCorsRejected               = "cors_rejected"
+	CodeRateLimited                = "rate_limited"
+	CodeRateLimitUnavailable       = "rate_limit_unavailable"
+	CodeNotFound                   = "not_found"
+	CodeInternalError              = "internal_error"
+)
+
+// problemTitles gives the title of each code, which is the same for every occurrence
+var problemTitles = map[string]string{
+	CodeInvalidJSON:                "Invalid JSON",
+	CodeInvalidOptions:             "Invalid options",
+	CodeInvalidMode:                "Invalid mode",
+	CodeBatchTooLarge:              "Batch too large",
+	CodeLineTooLong:                "Line too long",
+	CodeInvalidNDJSON:              "Invalid NDJSON",
+	CodeEnvelopeNotConfigured:      "Envelope encryption is not configured",
+	CodeDeterministicNotConfigured: "Deterministic encryption is not configured",
+	CodeInexactNumber:              "Inexact number",
+	CodeEncryptFailed:              "Encryption failed",
+	CodeDecryptFailed:              "Decryption failed",
+	CodeRewrapFailed:               "Rewrap failed",
+	CodeUnknownKey:                 "Unknown key",
+	CodeInvalidCiphertext:          "Invalid ciphertext",
+	CodeCiphertextRejected:         "Ciphertext rejected",
+	CodeSignFailed:                 "Signing failed",
+	CodeSignatureMismatch:          "Invalid signature",
+	CodeMalformedSignature:         "Malformed signature",
+	CodeInvalidData:                "Invalid data",
+	CodeNoPublicKey:                "No public key",
+	CodeUnauthorized:               "Unauthorized",
+	CodeInsufficientScope:          "Insufficient scope",
+	CodeCorsRejected:               "CORS request rejected",
+	CodeRateLimited:                "Too many requests",
+	CodeRateLimitUnavailable:       "Rate limiting is unavailable",
+	CodeNotFound:                   "Not found",
+	CodeInternalError:              "Internal server error",
+}
+
+// verificationCodes maps the reasons a signature is rejected for to their codes
+var verificationCodes = map[string]string{
+	service.ReasonMalformedSignature: CodeMalformedSignature,
+	service.ReasonMismatch:           CodeSignatureMismatch,
+	service.ReasonUnknownKey:         CodeUnknownKey,
+	service.ReasonInvalidData:        CodeInvalidData,
+}
+
+// Problem defines the body of every error response, as described by RFC 7807.
+// @Description Code is stable and meant for programs: one of invalid_json, invalid_options, invalid_mode, batch_too_large, line_too_long, invalid_ndjson, envelope_not_configured, deterministic_not_configured, inexact_number, encrypt_failed, decrypt_failed, rewrap_failed, unknown_key, invalid_ciphertext, ciphertext_rejected, sign_failed, signature_mismatch, malformed_signature, invalid_data, no_public_key, unauthorized, insufficient_scope, cors_rejected, rate_limited, rate_limit_unavailable, not_found or internal_error. Type is the code as a URI, title is the same for every occurrence of a code and detail explains this one
+type Problem struct {
+	Type   string `json:"type" example:"urn:riot:problem:invalid_json"`
+	Title  string `json:"title" example:"Invalid JSON"`
+	Status int    `json:"status" example:"400"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code" example:"invalid_json"`
+	// KeyID is the key a rejected signature or ciphertext names
+	KeyID string `json:"key_id,omitempty"`
+}
+
+func newProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   ProblemTypePrefix + code,
+		Title:  problemTitles[code],
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// problemFor maps an error to the problem the API responds with. Errors the client did not cause
+// get the fallback code of the operation that failed, without their message, which may come from
+// a crypto library or a key provider.
+func problemFor(err error, fallback string) Problem {
+	var unknownKey *service.UnknownKeyError
+	switch {
+	case errors.Is(err, errInvalidJSON):
+		return newProblem(http.StatusBadRequest, CodeInvalidJSON, "")
+	case errors.Is(err, service.ErrDeterministicUnsupported):
+		return newProblem(http.StatusBadRequest, CodeDeterministicNotConfigured, "")
+	case errors.Is(err, canonicalizer.ErrInexactNumber):
+		return newProblem(http.StatusBadRequest, CodeInexactNumber, "Numbers must be exactly representable as IEEE 754 doubles to be signed")
+	case errors.As(err, &unknownKey):
+		problem := newProblem(http.StatusBadRequest, CodeUnknownKey, "The ciphertext names a key that is not configured")
+		problem.KeyID = unknownKey.KeyID
+		return problem
+	case errors.Is(err, service.ErrUnknownKey):
+		return newProblem(http.StatusBadRequest, CodeUnknownKey, "The ciphertext names a key that is not configured")
+	case errors.Is(err, service.ErrInvalidCiphertext):
+		return newProblem(http.StatusBadRequest, CodeInvalidCiphertext, "A value is not a ciphertext this server can read")
+	case errors.Is(err, service.ErrAuthenticationFailed):
+		return newProblem(http.StatusBadRequest, CodeCiphertextRejected, "A ciphertext was tampered with, encrypted under another key, or moved from another field or context")
+	default:
+		return newProblem(http.StatusInternalServerError, fallback, "")
+	}
+}
+
+// verificationProblem describes why a signature was rejected.
+func verificationProblem(result service.VerificationResult) Problem {
+	code, ok := verificationCodes[result.Reason]
+	if !ok {
+		code = CodeSignatureMismatch
+	}
+	problem := newProblem(http.StatusBadRequest, code, "")
+	problem.KeyID = result.KeyID
+	return problem
+}
+
+// respondProblem writes the problem as an application/problem+json response and stops the
+// handlers that follow.
+func respondProblem(c *gin.Context, problem Problem) {
+	c.Set(problemCodeKey, problem.Code)
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// NotFound responds to requests for routes that do not exist.
+func NotFound(c *gin.Context) {
+	respondProblem(c, newProblem(http.StatusNotFound, CodeNotFound, "No route for "+c.Request.Method+" "+c.Request.URL.Path))
+}
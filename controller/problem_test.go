@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"riot-api/service"
+	"riot-api/tools"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblem_InvalidJSON(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/encrypt", bytes.NewBufferString(InvalidJsonPayload))
+
+	// Check
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "urn:riot:problem:invalid_json",
+		"title": "Invalid JSON",
+		"status": 400,
+		"code": "invalid_json"
+	}`, w.Body.String())
+}
+
+func TestProblem_UnknownKey(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	keyring, _ := tools.NewKeyring("v2", []byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	encryptor, _ := tools.NewAESKeyringEncryptor(keyring)
+	signingKeyring, _ := tools.NewKeyring("v2", []byte(SigningKeyTest))
+	cryptoController := NewCryptoController(tools.NewHMACKeyringSigner(signingKeyring), encryptor)
+	router.POST("/decrypt", cryptoController.Decrypt)
+	router.POST("/verify", cryptoController.Verify)
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/decrypt", bytes.NewBufferString(`{"ssn": "riot:v1:aes-256-gcm:v1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}`))
+	wVerify := performRequest(router, http.MethodPost, "/verify", bytes.NewBufferString(`{"signature": "v1`+tools.KeyIDSeparator+SignatureValidJsonPayload+`", "data": {"key1": "value1"}}`))
+
+	// Check
+	var problem, verifyProblem Problem
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	json.Unmarshal(wVerify.Body.Bytes(), &verifyProblem)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, CodeUnknownKey, problem.Code)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, "v1", problem.KeyID)
+	// An unknown key gets the same status whether it names a ciphertext or a signature key
+	assert.Equal(t, CodeUnknownKey, verifyProblem.Code)
+	assert.Equal(t, wVerify.Code, w.Code)
+}
+
+func TestProblem_CiphertextRejected(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	keyring, _ := tools.NewKeyring("v1", []byte("mpIZXC9uEsTe7f9g1fXXMspXliOCWNOg"))
+	encryptor, _ := tools.NewAESKeyringEncryptor(keyring)
+	otherKeyring, _ := tools.NewKeyring("v1", []byte("0123456789abcdef0123456789abcdef"))
+	otherEncryptor, _ := tools.NewAESKeyringEncryptor(otherKeyring)
+	cryptoController := NewCryptoController(tools.NewHMACSigner([]byte(SigningKeyTest)), encryptor)
+	router.POST("/decrypt", cryptoController.Decrypt)
+
+	ciphertext, _ := encryptor.EncryptValue(service.KeyBinding("ssn", ""), "123-45-6789")
+	// Flip a bit of the tag, the last byte of the payload
+	payload, _ := base64.StdEncoding.DecodeString(ciphertext[strings.LastIndex(ciphertext, ":")+1:])
+	payload[len(payload)-1] ^= 1
+	tampered := ciphertext[:strings.LastIndex(ciphertext, ":")+1] + base64.StdEncoding.EncodeToString(payload)
+	wrongKey, _ := otherEncryptor.EncryptValue(service.KeyBinding("ssn", ""), "123-45-6789")
+
+	for name, value := range map[string]string{"tampered tag": tampered, "wrong key": wrongKey} {
+		// Perform
+		w := performRequest(router, http.MethodPost, "/decrypt", bytes.NewBufferString(`{"ssn": "`+value+`"}`))
+
+		// Check
+		var problem Problem
+		json.Unmarshal(w.Body.Bytes(), &problem)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+		assert.Equal(t, CodeCiphertextRejected, problem.Code, name)
+		assert.NotContains(t, problem.Detail, "cipher:", name)
+	}
+}
+
+func TestProblemFor_HidesInternalErrors(t *testing.T) {
+	// Perform
+	problem := problemFor(errors.New("vault: permission denied for transit/keys/riot"), CodeDecryptFailed)
+
+	// Check
+	assert.Equal(t, http.StatusInternalServerError, problem.Status)
+	assert.Equal(t, CodeDecryptFailed, problem.Code)
+	assert.Empty(t, problem.Detail)
+}
+
+func TestProblem_SignatureKeyID(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	keyring, _ := tools.NewKeyring("v1", []byte(SigningKeyTest))
+	cryptoController := NewCryptoController(tools.NewHMACKeyringSigner(keyring), tools.NewBase64Encryptor())
+	router.POST("/verify", cryptoController.Verify)
+	body := `{"signature": "v9` + tools.KeyIDSeparator + SignatureValidJsonPayload + `", "data": {"key1": "value1"}}`
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/verify", bytes.NewBufferString(body))
+
+	// Check
+	var problem Problem
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, CodeUnknownKey, problem.Code)
+	assert.Equal(t, "v9", problem.KeyID)
+}
+
+func TestNotFound(t *testing.T) {
+	// Prepare
+	router := setUpRouter()
+	router.NoRoute(NotFound)
+
+	// Perform
+	w := performRequest(router, http.MethodPost, "/missing", nil)
+
+	// Check
+	var problem Problem
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, CodeNotFound, problem.Code)
+}
+
+func TestRecover(t *testing.T) {
+	// Prepare
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.CustomRecovery(Recover))
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	// Perform
+	w := performRequest(router, http.MethodGet, "/panic", nil)
+
+	// Check
+	var problem Problem
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, CodeInternalError, problem.Code)
+	assert.Empty(t, problem.Detail)
+}
@@ -15,49 +15,511 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/decrypt": {
+        "/batch/decrypt": {
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Decrypts every item of the array as /decrypt would, with the same options and mode applied to each. Items are processed concurrently and a failed item does not fail the others.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "Batch"
+                ],
+                "summary": "Decrypts each item of a batch",
+                "parameters": [
+                    {
+                        "description": "Documents to decrypt",
+                        "name": "items",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "object"
+                            }
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Context the values of every item were encrypted with",
+                        "name": "X-Encryption-Context",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "strict",
+                            "passthrough"
+                        ],
+                        "type": "string",
+                        "description": "Decryption mode, defaults to the server setting",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath or JSON Pointer of the values to decrypt in each item",
+                        "name": "select",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 32,
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "Decrypt the values found at this depth in each item",
+                        "name": "depth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath or JSON Pointer of the deterministically encrypted values",
+                        "name": "deterministic",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Each item is a controller.WrappedPayload",
+                        "name": "envelope",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Decrypted items",
+                        "schema": {
+                            "$ref": "#/definitions/controller.BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_json, invalid_mode, invalid_options, batch_too_large or envelope_not_configured",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/batch/encrypt": {
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Encrypts every item of the array as /encrypt would, with the same options applied to each. Items are processed concurrently and a failed item does not fail the others.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "Batch"
+                ],
+                "summary": "Encrypts each item of a batch",
+                "parameters": [
+                    {
+                        "description": "Documents to encrypt",
+                        "name": "items",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "object"
+                            }
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Context bound to the ciphertexts of every item",
+                        "name": "X-Encryption-Context",
+                        "in": "header"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath or JSON Pointer of the values to encrypt in each item",
+                        "name": "select",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 32,
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "Encrypt the values found at this depth in each item",
+                        "name": "depth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Encrypt each item under its own data key",
+                        "name": "envelope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath or JSON Pointer of the values to encrypt deterministically with AES-SIV",
+                        "name": "deterministic",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Encrypted items",
+                        "schema": {
+                            "$ref": "#/definitions/controller.BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_json, invalid_options, batch_too_large or envelope_not_configured",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/batch/sign": {
             "post": {
-                "description": "Decrypts the Base64 encoded values in the object at depth 1.",
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Signs every item of the array as /sign would. Items are processed concurrently and a failed item does not fail the others.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "Batch"
+                ],
+                "summary": "Signs each item of a batch",
+                "parameters": [
+                    {
+                        "description": "Documents to sign",
+                        "name": "items",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "object"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Signatures, as {\\\"signature\\\": ...} objects",
+                        "schema": {
+                            "$ref": "#/definitions/controller.BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_json or batch_too_large",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/batch/verify": {
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Verifies the signature of every item of the array as /verify would. A valid signature gives {\"valid\": true}, a rejected one gives the controller.Problem returned by /verify.",
+                "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "Batch"
+                ],
+                "summary": "Verifies each item of a batch",
+                "parameters": [
+                    {
+                        "description": "Signature verification requests",
+                        "name": "items",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.VerifyRequest"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Verification results",
+                        "schema": {
+                            "$ref": "#/definitions/controller.BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_json or batch_too_large",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/decrypt": {
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Decrypts the encrypted values in the object or array at depth 1, or the encrypted scalar, using the configured algorithm, or the values selected by select or depth.\nIn strict mode every value must be a ciphertext. In passthrough mode values that are not recognised ciphertexts are returned unchanged, and the response lists the decrypted keys.\nWith Content-Type application/x-ndjson the body is read one JSON document per line and each result is streamed back as a line, or as a controller.NDJSONError when that line fails.",
+                "consumes": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/problem+json",
+                    "application/x-ndjson"
+                ],
                 "tags": [
                     "Encryption"
                 ],
                 "summary": "Decrypts the given data",
                 "parameters": [
                     {
-                        "description": "Data to decrypt",
+                        "description": "JSON document to decrypt",
                         "name": "data",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "object"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Context the values were encrypted with",
+                        "name": "X-Encryption-Context",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "strict",
+                            "passthrough"
+                        ],
+                        "type": "string",
+                        "description": "Decryption mode, defaults to the server setting",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath or JSON Pointer of the values to decrypt, as given to /encrypt",
+                        "name": "select",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 32,
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "Decrypt the values found at this depth, as given to /encrypt",
+                        "name": "depth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath or JSON Pointer of the deterministically encrypted values, as given to /encrypt",
+                        "name": "deterministic",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "The data is a controller.WrappedPayload returned by /encrypt?envelope=true",
+                        "name": "envelope",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Decrypted data",
+                        "description": "Decrypted data, wrapped in a controller.DecryptResponse in passthrough mode",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "object"
                         }
                     },
                     "400": {
-                        "description": "Invalid JSON",
+                        "description": "invalid_json, invalid_mode, invalid_options, envelope_not_configured, invalid_ciphertext, ciphertext_rejected or unknown_key with its key_id",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "decrypt_failed",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.Problem"
                         }
                     }
                 }
@@ -65,12 +527,20 @@ const docTemplate = `{
         },
         "/encrypt": {
             "post": {
-                "description": "Encrypts the values of the object at a depth of 1 using Base64 encoding.",
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Encrypts the values of the object at a depth of 1 using the configured algorithm (Base64 by default). The elements of an array are encrypted like the values of an object, and a scalar is encrypted as a whole.\nWith select or depth, only the selected nested values are encrypted and the shape of the document is kept.\nValues selected by deterministic are encrypted with AES-SIV, which always gives the same ciphertext for the same value, field and context. This allows equality lookups on encrypted fields but reveals which values are equal: every other value keeps randomized encryption.\nWith AES-256-GCM, ChaCha20-Poly1305 or XChaCha20-Poly1305 each ciphertext is authenticated along with its field name and the optional context, so it fails to decrypt if moved to another field or record.\nWith Content-Type application/x-ndjson the body is read one JSON document per line and each result is streamed back as a line, or as a controller.NDJSONError when that line fails.",
                 "consumes": [
-                    "application/json"
+                    "application/json",
+                    "application/x-ndjson"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "application/problem+json",
+                    "application/x-ndjson"
                 ],
                 "tags": [
                     "Encryption"
@@ -78,36 +548,217 @@ const docTemplate = `{
                 "summary": "Encrypts the given data",
                 "parameters": [
                     {
-                        "description": "Data to encrypt",
+                        "description": "JSON document to encrypt: an object, an array or a scalar",
                         "name": "data",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "object"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Context bound to the ciphertexts, such as a tenant or record ID. Required again to decrypt them",
+                        "name": "X-Encryption-Context",
+                        "in": "header"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath ($.user.ssn, $.cards[*].pan) or JSON Pointer (/user/ssn) of the values to encrypt, keeping the rest of the document readable",
+                        "name": "select",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 32,
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "Encrypt the values found at this depth, and any scalar above it, instead of whole top-level values",
+                        "name": "depth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Encrypt under a fresh data key, returned wrapped under the master key in a controller.WrappedPayload",
+                        "name": "envelope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "JSONPath or JSON Pointer of the values to encrypt deterministically with AES-SIV, such as $.email. Equal values in the same field and context get equal ciphertexts, so they can be looked up and joined on, but anyone reading the ciphertexts can tell which values are equal and how often each occurs. Only use it for fields that need equality lookups",
+                        "name": "deterministic",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Encrypted data",
+                        "description": "Encrypted data, wrapped in a controller.WrappedPayload with envelope=true",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_json, invalid_options, deterministic_not_configured or envelope_not_configured",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "encrypt_failed",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/public-key": {
+            "get": {
+                "description": "Returns the public keys of the configured asymmetric signing algorithm (ed25519, ecdsa-p256 or rsa-pss-sha256), so third parties can verify signatures offline: the active key, and the retired keys that still verify older signatures. A signature is verified with the key whose ID prefixes it. Not available with HMAC signing.",
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "Signing"
+                ],
+                "summary": "Returns the public keys used to verify signatures",
+                "responses": {
+                    "200": {
+                        "description": "Public key",
+                        "schema": {
+                            "$ref": "#/definitions/controller.PublicKeyResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "no_public_key with HMAC signing",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
                             }
                         }
                     },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rewrap": {
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Unwraps the data key of a payload encrypted with /encrypt?envelope=true and wraps it again under the active master key, so retired master keys can be removed without re-encrypting any payload.\nThe data, if given, is returned unchanged: nothing is decrypted and neither the data key nor any plaintext is returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "Encryption"
+                ],
+                "summary": "Rewraps a data key under the active master key",
+                "parameters": [
+                    {
+                        "description": "Wrapped data key, with optional data",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.WrappedPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Rewrapped data key",
+                        "schema": {
+                            "$ref": "#/definitions/controller.WrappedPayload"
+                        }
+                    },
                     "400": {
-                        "description": "Invalid JSON",
+                        "description": "invalid_json, envelope_not_configured, invalid_ciphertext, ciphertext_rejected or unknown_key with its key_id",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "rewrap_failed",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.Problem"
                         }
                     }
                 }
@@ -115,12 +766,18 @@ const docTemplate = `{
         },
         "/sign": {
             "post": {
-                "description": "Computes an HMAC signature using the provided data and a secret key.",
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Signs the RFC 8785 canonical form of the provided JSON document, which may be an object, an array or a scalar, with the configured SIGNING_ALGORITHM: hmac-sha256 (the default), ed25519, ecdsa-p256 or rsa-pss-sha256. The signature is prefixed with the ID of the signing key, when it has one.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "application/problem+json"
                 ],
                 "tags": [
                     "Signing"
@@ -128,13 +785,12 @@ const docTemplate = `{
                 "summary": "Generates a cryptographic signature for the given data",
                 "parameters": [
                     {
-                        "description": "Data to sign",
+                        "description": "JSON document to sign: an object, an array or a scalar",
                         "name": "data",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "object"
                         }
                     }
                 ],
@@ -149,15 +805,39 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid JSON",
+                        "description": "invalid_json, or inexact_number for a number such as an integer above 2^53 that cannot be signed exactly",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "sign_failed",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.Problem"
                         }
                     }
                 }
@@ -165,12 +845,18 @@ const docTemplate = `{
         },
         "/verify": {
             "post": {
-                "description": "Verifies if the provided HMAC signature matches the computed signature for the data.",
+                "security": [
+                    {
+                        "APIKey": []
+                    }
+                ],
+                "description": "Verifies the provided signature of the data with the configured SIGNING_ALGORITHM (hmac-sha256, ed25519, ecdsa-p256 or rsa-pss-sha256), using the key whose ID prefixes the signature.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "application/problem+json"
                 ],
                 "tags": [
                     "Signing"
@@ -192,9 +878,33 @@ const docTemplate = `{
                         "description": "Signature is valid"
                     },
                     "400": {
-                        "description": "Invalid JSON or Invalid signature",
+                        "description": "invalid_json, or signature_mismatch, malformed_signature, unknown_key or invalid_data with the key_id of the signature",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "insufficient_scope",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Problem"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
                         }
                     }
                 }
@@ -202,18 +912,127 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "controller.BatchResponse": {
+            "description": "Results are in the order of the request items",
+            "type": "object",
+            "properties": {
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/controller.BatchResult"
+                    }
+                }
+            }
+        },
+        "controller.BatchResult": {
+            "description": "Index is the position of the item in the request. A successful item has data, a failed one has error, the controller.Problem the single-item endpoint would respond with",
+            "type": "object",
+            "properties": {
+                "data": {},
+                "error": {
+                    "$ref": "#/definitions/controller.Problem"
+                },
+                "index": {
+                    "type": "integer"
+                }
+            }
+        },
+        "controller.Problem": {
+            "description": "Code is stable and meant for programs: one of invalid_json, invalid_options, invalid_mode, batch_too_large, line_too_long, invalid_ndjson, envelope_not_configured, deterministic_not_configured, inexact_number, encrypt_failed, decrypt_failed, rewrap_failed, unknown_key, invalid_ciphertext, ciphertext_rejected, sign_failed, signature_mismatch, malformed_signature, invalid_data, no_public_key, unauthorized, insufficient_scope, cors_rejected, rate_limited, rate_limit_unavailable, not_found or internal_error. Type is the code as a URI, title is the same for every occurrence of a code and detail explains this one",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "invalid_json"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "key_id": {
+                    "description": "KeyID is the key a rejected signature or ciphertext names",
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Invalid JSON"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "urn:riot:problem:invalid_json"
+                }
+            }
+        },
+        "controller.PublicKeyEntry": {
+            "type": "object",
+            "properties": {
+                "key_id": {
+                    "type": "string"
+                },
+                "public_key": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.PublicKeyResponse": {
+            "description": "PublicKey is the PEM encoded PKIX (SubjectPublicKeyInfo) public key of the active key, whose ID prefixes new signatures. Keys also lists the public keys of the retired keys, which still verify older signatures",
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "key_id": {
+                    "type": "string"
+                },
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/controller.PublicKeyEntry"
+                    }
+                },
+                "public_key": {
+                    "type": "string"
+                }
+            }
+        },
         "controller.VerifyRequest": {
             "description": "This is used for the request body of /verify",
             "type": "object",
+            "required": [
+                "signature"
+            ],
             "properties": {
                 "data": {
-                    "type": "object",
-                    "additionalProperties": true
+                    "description": "Data is the signed JSON document, an object, an array or a scalar other than null"
                 },
                 "signature": {
                     "type": "string"
                 }
             }
+        },
+        "controller.WrappedPayload": {
+            "description": "Returned by /encrypt?envelope=true and accepted by /decrypt?envelope=true and /rewrap",
+            "type": "object",
+            "required": [
+                "wrapped_key"
+            ],
+            "properties": {
+                "data": {},
+                "wrapped_key": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "APIKey": {
+            "description": "API key, as \"Bearer \u003ckey\u003e\". Only required when API_KEYS_FILE is set",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
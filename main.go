@@ -1,55 +1,501 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"riot-api/controller"
+	"riot-api/service"
 	"riot-api/tools"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "riot-api/docs"
 
-	"github.com/didip/tollbooth/v7"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+// @securityDefinitions.apikey APIKey
+// @in header
+// @name Authorization
+// @description API key, as "Bearer <key>". Only required when API_KEYS_FILE is set
 func main() {
 	setupEnv()
+	logger := setupLogger()
 	cryptoController := initCryptoController()
-	r := setupRouter(cryptoController)
-	r.Run(":8022")
+	apiKeys := initAPIKeyStore()
+	rateLimitStore := initRateLimitStore()
+	rateLimitPolicy := initRateLimitPolicy()
+	watchKeyReloads(cryptoController, apiKeys)
+	r := setupRouter(cryptoController, apiKeys, rateLimitStore, rateLimitPolicy, logger)
+	warnUnknownRateLimitRoutes(r, rateLimitPolicy)
+	log.Fatal(serve(r))
 }
 
+// serve listens on port 8022, over TLS when TLS_CERT and TLS_KEY are set. With TLS_CLIENT_CA,
+// clients must also present a certificate issued by one of its CAs.
+func serve(handler http.Handler) error {
+	if os.Getenv("TLS_CERT") == "" {
+		log.Printf("TLS_CERT is not set: serving plain HTTP")
+		return http.ListenAndServe(":8022", handler)
+	}
+
+	tlsConfig, err := tools.NewServerTLSConfig(os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY"), os.Getenv("TLS_CLIENT_CA"))
+	if err != nil {
+		return fmt.Errorf("TLS: %w", err)
+	}
+	server := &http.Server{Addr: ":8022", Handler: handler, TLSConfig: tlsConfig}
+	return server.ListenAndServeTLS("", "")
+}
+
+// setupLogger returns the JSON logger of the access logs, redacting the default fields and those of
+// LOG_REDACT_FIELDS, and makes it the default so that every other log goes through it too.
+func setupLogger() *slog.Logger {
+	logger := slog.New(controller.NewLogHandler(os.Stdout, slog.LevelInfo, settingList("LOG_REDACT_FIELDS")))
+	slog.SetDefault(logger)
+	return logger
+}
+
+var (
+	// processEnv holds the names of the settings of the process environment, which .env never overrides
+	processEnv = make(map[string]bool)
+	// envFile holds the settings applied from .env
+	envFile map[string]string
+)
+
+// setupEnv loads .env, whose settings never override those of the process environment.
 func setupEnv() {
-	if err := godotenv.Load(".env"); err != nil {
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		processEnv[name] = true
+	}
+
+	settings, err := readEnvFile()
+	if err != nil {
 		log.Fatalf("Error loading .env file")
 	}
+	applyEnvFile(settings)
+
+	if err := validateSettings(os.Getenv); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readEnvFile reads the settings of .env that the process environment does not set.
+func readEnvFile() (map[string]string, error) {
+	settings, err := godotenv.Read(".env")
+	if err != nil {
+		return nil, err
+	}
+	for name := range processEnv {
+		delete(settings, name)
+	}
+	return settings, nil
+}
+
+// applyEnvFile sets the settings read from .env, unsetting those previously applied from it that it
+// no longer has.
+func applyEnvFile(settings map[string]string) {
+	for name := range envFile {
+		if _, ok := settings[name]; !ok {
+			os.Unsetenv(name)
+		}
+	}
+	for name, value := range settings {
+		os.Setenv(name, value)
+	}
+	envFile = settings
+}
+
+// validateSettings checks the settings that are not keys, which are checked when loaded, as
+// getenv returns them.
+func validateSettings(getenv func(name string) string) error {
+	switch getenv("KEY_PROVIDER") {
+	case "", "env", "file", "vault":
+	default:
+		return fmt.Errorf("KEY_PROVIDER %q is not supported", getenv("KEY_PROVIDER"))
+	}
+
+	switch getenv("SIGNING_ALGORITHM") {
+	case "", tools.HMACSHA256Algorithm, tools.Ed25519Algorithm, tools.ECDSAP256Algorithm, tools.RSAPSSAlgorithm:
+	default:
+		return fmt.Errorf("SIGNING_ALGORITHM %q is not supported", getenv("SIGNING_ALGORITHM"))
+	}
+
+	switch getenv("DECRYPT_MODE") {
+	case "", service.DecryptModeStrict, service.DecryptModePassthrough:
+	default:
+		return fmt.Errorf("DECRYPT_MODE %q is not supported", getenv("DECRYPT_MODE"))
+	}
+
+	switch getenv("ENCRYPTION_ALGORITHM") {
+	case "", tools.Base64Algorithm, tools.AES256GCMAlgorithm, tools.ChaCha20Poly1305Algorithm, tools.XChaCha20Poly1305Algorithm:
+	default:
+		return fmt.Errorf("ENCRYPTION_ALGORITHM %q is not supported", getenv("ENCRYPTION_ALGORITHM"))
+	}
 
-	if os.Getenv("SIGNING_KEY") == "" {
-		log.Fatalf("SIGNING_KEY environment variable is not set")
+	switch getenv("RATE_LIMIT_STORE") {
+	case "", "memory":
+	case "redis":
+		if getenv("REDIS_URL") == "" {
+			return errors.New("RATE_LIMIT_STORE \"redis\" requires REDIS_URL")
+		}
+	default:
+		return fmt.Errorf("RATE_LIMIT_STORE %q is not supported", getenv("RATE_LIMIT_STORE"))
 	}
+
+	switch getenv("RATE_LIMIT_FAILURE_MODE") {
+	case "", "open", "closed":
+	default:
+		return fmt.Errorf("RATE_LIMIT_FAILURE_MODE %q is not supported", getenv("RATE_LIMIT_FAILURE_MODE"))
+	}
+
+	if (getenv("TLS_CERT") == "") != (getenv("TLS_KEY") == "") {
+		return errors.New("TLS_CERT and TLS_KEY must be set together")
+	}
+	if getenv("TLS_CLIENT_CA") != "" && getenv("TLS_CERT") == "" {
+		return errors.New("TLS_CLIENT_CA requires TLS_CERT and TLS_KEY")
+	}
+
+	for _, proxy := range splitSetting(getenv("TRUSTED_PROXIES")) {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("TRUSTED_PROXIES %q must be an IP address or a CIDR range", proxy)
+		}
+	}
+
+	for _, origin := range splitSetting(getenv("CORS_ALLOWED_ORIGINS")) {
+		if strings.Count(origin, "*") > 1 || (origin != "*" && strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+			return fmt.Errorf("CORS_ALLOWED_ORIGINS %q must be an origin, a wildcard subdomain like https://*.example.com or *", origin)
+		}
+		if origin == "*" && getenv("CORS_ALLOW_CREDENTIALS") == "true" {
+			return errors.New("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list the origins")
+		}
+	}
+	switch getenv("CORS_ALLOW_CREDENTIALS") {
+	case "", "true", "false":
+	default:
+		return fmt.Errorf("CORS_ALLOW_CREDENTIALS %q must be true or false", getenv("CORS_ALLOW_CREDENTIALS"))
+	}
+	if maxAge := getenv("CORS_MAX_AGE"); maxAge != "" {
+		if seconds, err := strconv.Atoi(maxAge); err != nil || seconds < 0 {
+			return errors.New("CORS_MAX_AGE must be a number of seconds")
+		}
+	}
+
+	if workers := getenv("BATCH_WORKERS"); workers != "" {
+		if batchWorkers, err := strconv.Atoi(workers); err != nil || batchWorkers < 1 {
+			return errors.New("BATCH_WORKERS must be a positive integer")
+		}
+	}
+	return nil
 }
 
 func initCryptoController() *controller.CryptoController {
-	signer := tools.NewHMACSigner([]byte(os.Getenv("SIGNING_KEY")))
-	encryptor := tools.NewBase64Encryptor()
-	return controller.NewCryptoController(signer, encryptor)
+	signer, encryptor, keyWrapper, err := loadKeys()
+	if err != nil {
+		log.Fatalf("Error loading keys: %v", err)
+	}
+
+	var options []controller.Option
+	if mode := os.Getenv("DECRYPT_MODE"); mode != "" {
+		options = append(options, controller.WithDecryptMode(mode))
+	}
+	if keyWrapper != nil {
+		options = append(options, controller.WithKeyWrapper(keyWrapper))
+	}
+	if workers := os.Getenv("BATCH_WORKERS"); workers != "" {
+		batchWorkers, _ := strconv.Atoi(workers)
+		options = append(options, controller.WithBatchWorkers(batchWorkers))
+	}
+	return controller.NewCryptoController(signer, encryptor, options...)
+}
+
+// initAPIKeyStore returns the API keys of API_KEYS_FILE, or nil when it is not set and every
+// endpoint is open.
+func initAPIKeyStore() *tools.FileAPIKeyStore {
+	path := os.Getenv("API_KEYS_FILE")
+	if path == "" {
+		log.Printf("API_KEYS_FILE is not set: every endpoint is open to anyone who can reach the server")
+		return nil
+	}
+
+	apiKeys, err := tools.NewFileAPIKeyStore(path)
+	if err != nil {
+		log.Fatalf("Error loading API keys: %v", err)
+	}
+	return apiKeys
 }
 
-func setupRouter(cryptoController *controller.CryptoController) *gin.Engine {
-	r := gin.Default()
-	rateLimiter := tollbooth.NewLimiter(1000, nil)
+// initRateLimitStore returns the store of the rate limiting budgets, in Redis when they are shared
+// by every replica or else in memory.
+func initRateLimitStore() service.RateLimitStore {
+	if os.Getenv("RATE_LIMIT_STORE") != "redis" {
+		return tools.NewMemoryRateLimitStore()
+	}
+
+	options, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	if err != nil {
+		log.Fatalf("Error configuring rate limiting: REDIS_URL: %v", err)
+	}
+	return tools.NewRedisRateLimitStore(redis.NewClient(options))
+}
+
+// corsConfig returns controller.DefaultCorsConfig with the CORS settings that are set.
+func corsConfig() controller.CorsConfig {
+	config := controller.DefaultCorsConfig
+	if origins := settingList("CORS_ALLOWED_ORIGINS"); origins != nil {
+		config.AllowedOrigins = origins
+	}
+	if methods := settingList("CORS_ALLOWED_METHODS"); methods != nil {
+		config.AllowedMethods = methods
+	}
+	if headers := settingList("CORS_ALLOWED_HEADERS"); headers != nil {
+		config.AllowedHeaders = headers
+	}
+	config.AllowCredentials = os.Getenv("CORS_ALLOW_CREDENTIALS") == "true"
+	if maxAge := os.Getenv("CORS_MAX_AGE"); maxAge != "" {
+		seconds, _ := strconv.Atoi(maxAge)
+		config.MaxAge = time.Duration(seconds) * time.Second
+	}
+	return config
+}
+
+// settingList splits a comma separated setting, returning nil when it is not set.
+func settingList(name string) []string {
+	return splitSetting(os.Getenv(name))
+}
+
+func splitSetting(setting string) []string {
+	var values []string
+	for _, value := range strings.Split(setting, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// initRateLimitPolicy returns the limits of RATE_LIMITS_FILE, or service.DefaultRateLimit for
+// every caller and route when it is not set.
+func initRateLimitPolicy() service.RateLimitPolicy {
+	path := os.Getenv("RATE_LIMITS_FILE")
+	if path == "" {
+		return service.RateLimitPolicy{Default: service.DefaultRateLimit}
+	}
+
+	policy, err := tools.LoadRateLimitPolicy(path)
+	if err != nil {
+		log.Fatalf("Error loading rate limits: %v", err)
+	}
+	return policy
+}
+
+// warnUnknownRateLimitRoutes logs the routes of the policy the router does not serve, which are
+// most likely typos.
+func warnUnknownRateLimitRoutes(r *gin.Engine, policy service.RateLimitPolicy) {
+	known := make(map[string]bool)
+	for _, route := range r.Routes() {
+		known[route.Path] = true
+	}
+
+	routes := make([]map[string]service.RateLimit, 0, len(policy.Identities)+1)
+	routes = append(routes, policy.Routes)
+	for _, limits := range policy.Identities {
+		routes = append(routes, limits.Routes)
+	}
+	for _, limits := range routes {
+		for route := range limits {
+			if !known[route] {
+				log.Printf("Rate limit of route %q: no such route", route)
+			}
+		}
+	}
+}
+
+// loadKeys reads the keys from the configured provider and builds everything that uses them.
+// The key wrapper is nil when no encryption key is configured.
+func loadKeys() (service.Signer, service.Encryptor, service.KeyWrapper, error) {
+	keyProvider, err := initKeyProvider()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("key provider: %w", err)
+	}
+	signer, err := initSigner(keyProvider)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("signer: %w", err)
+	}
+	encryptionKeyring, err := initEncryptionKeyring(keyProvider)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("encryption keys: %w", err)
+	}
+	encryptor, err := initEncryptor(encryptionKeyring)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("encryptor: %w", err)
+	}
+
+	// Envelope encryption wraps data keys under master keys derived from the encryption keys
+	if encryptionKeyring == nil {
+		return signer, encryptor, nil, nil
+	}
+	keyWrapper, err := tools.NewKeyWrapper(encryptionKeyring)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("key wrapper: %w", err)
+	}
+	return signer, encryptor, keyWrapper, nil
+}
+
+// initKeyProvider returns the source of every key, chosen by KEY_PROVIDER.
+func initKeyProvider() (service.KeyProvider, error) {
+	switch os.Getenv("KEY_PROVIDER") {
+	case "file":
+		return tools.NewFileKeyProvider(os.Getenv("KEYRING_FILE"))
+
+	case "vault":
+		signingExportType := tools.VaultSigningKey
+		if algorithm := os.Getenv("SIGNING_ALGORITHM"); algorithm == "" || algorithm == tools.HMACSHA256Algorithm {
+			signingExportType = tools.VaultHMACKey
+		}
+
+		keys := map[string]tools.VaultKey{
+			service.PurposeSigning: {Name: os.Getenv("VAULT_SIGNING_KEY"), ExportType: signingExportType},
+		}
+		if name := os.Getenv("VAULT_ENCRYPTION_KEY"); name != "" {
+			keys[service.PurposeEncryption] = tools.VaultKey{Name: name, ExportType: tools.VaultEncryptionKey}
+		}
+
+		mount := os.Getenv("VAULT_TRANSIT_MOUNT")
+		if mount == "" {
+			mount = "transit"
+		}
+		return tools.NewVaultKeyProvider(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"), mount, keys), nil
+
+	default:
+		return tools.NewEnvKeyProvider(os.Getenv), nil
+	}
+}
+
+// initSigner returns the signer of SIGNING_ALGORITHM. Whatever the algorithm, it signs with the
+// active key and verifies with the active and retired keys.
+func initSigner(keyProvider service.KeyProvider) (service.Signer, error) {
+	keyring, err := tools.NewKeyringFromProvider(keyProvider, service.PurposeSigning, func(material []byte) ([]byte, error) {
+		return material, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch os.Getenv("SIGNING_ALGORITHM") {
+	case tools.Ed25519Algorithm:
+		return tools.NewEd25519KeyringSigner(keyring)
+	case tools.ECDSAP256Algorithm:
+		return tools.NewECDSAKeyringSigner(keyring)
+	case tools.RSAPSSAlgorithm:
+		return tools.NewRSAPSSKeyringSigner(keyring)
+	default:
+		return tools.NewHMACKeyringSigner(keyring), nil
+	}
+}
+
+// initEncryptionKeyring returns the encryption keys, or nil when none is configured and only
+// base64 can be used.
+func initEncryptionKeyring(keyProvider service.KeyProvider) (*tools.Keyring, error) {
+	keyring, err := tools.NewKeyringFromProvider(keyProvider, service.PurposeEncryption, func(material []byte) ([]byte, error) {
+		return tools.DecodeKey(string(material), tools.AES256KeySize)
+	})
+	if errors.Is(err, service.ErrNoActiveKey) {
+		algorithm := os.Getenv("ENCRYPTION_ALGORITHM")
+		if algorithm != "" && algorithm != tools.Base64Algorithm {
+			return nil, fmt.Errorf("ENCRYPTION_ALGORITHM %q requires an encryption key: %w", algorithm, err)
+		}
+		return nil, nil
+	}
+	return keyring, err
+}
+
+func initEncryptor(keyring *tools.Keyring) (service.Encryptor, error) {
+	base64Encryptor := tools.NewBase64Encryptor()
+	if keyring == nil {
+		return tools.NewDispatchingEncryptor(base64Encryptor), nil
+	}
+
+	aesEncryptor, err := tools.NewAESKeyringEncryptor(keyring)
+	if err != nil {
+		return nil, err
+	}
+	chachaEncryptor, err := tools.NewChaCha20KeyringEncryptor(keyring)
+	if err != nil {
+		return nil, err
+	}
+	xchachaEncryptor, err := tools.NewXChaCha20KeyringEncryptor(keyring)
+	if err != nil {
+		return nil, err
+	}
+	// Only used for the values a request selects for deterministic encryption
+	sivEncryptor, err := tools.NewAESSIVKeyringEncryptor(keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	// Values encrypted with any configured algorithm remain decryptable
+	encryptors := []service.ValueEncryptor{base64Encryptor, aesEncryptor, chachaEncryptor, xchachaEncryptor, sivEncryptor}
+	for i, encryptor := range encryptors {
+		if encryptor.Algorithm() == os.Getenv("ENCRYPTION_ALGORITHM") {
+			encryptors[0], encryptors[i] = encryptors[i], encryptors[0]
+		}
+	}
+	return tools.NewDispatchingEncryptor(encryptors[0], encryptors[1:]...), nil
+}
+
+func setupRouter(cryptoController *controller.CryptoController, apiKeys *tools.FileAPIKeyStore, rateLimitStore service.RateLimitStore, rateLimitPolicy service.RateLimitPolicy, logger *slog.Logger) *gin.Engine {
+	// Gin's debug output would bypass the JSON logs
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	// The client IP, which unauthenticated callers are rate limited by, is only read from the
+	// X-Forwarded-For and X-Real-IP headers set by the trusted proxies
+	if err := r.SetTrustedProxies(settingList("TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
+	r.Use(controller.AccessLog(logger), gin.CustomRecovery(controller.Recover))
+	r.NoRoute(controller.NotFound)
+	// Without its store, rate limiting lets requests through unless it must fail closed
+	failOpen := os.Getenv("RATE_LIMIT_FAILURE_MODE") != "closed"
+
+	r.Use(controller.ClientCertificate)
+	r.Use(controller.Cors(corsConfig()))
+	// Callers are known before rate limiting, so each API key gets its own budget
+	if apiKeys != nil {
+		r.Use(controller.Authenticate(apiKeys))
+	}
+	r.Use(controller.RateLimiter(rateLimitStore, rateLimitPolicy, failOpen))
+
+	authorize := func(scope string) gin.HandlerFunc {
+		if apiKeys == nil {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return controller.RequireScope(apiKeys, scope)
+	}
 
-	r.Use(controller.Cors)
-	r.Use(controller.RateLimiter(rateLimiter))
+	r.POST("/encrypt", authorize(service.ScopeEncrypt), cryptoController.Encrypt)
+	r.POST("/decrypt", authorize(service.ScopeDecrypt), cryptoController.Decrypt)
+	// Rewrapping opens data keys, even though it returns none
+	r.POST("/rewrap", authorize(service.ScopeDecrypt), cryptoController.Rewrap)
+	r.POST("/sign", authorize(service.ScopeSign), cryptoController.Sign)
+	r.POST("/verify", authorize(service.ScopeVerify), cryptoController.Verify)
+	r.GET("/public-key", cryptoController.PublicKey)
 
-	r.POST("/encrypt", cryptoController.Encrypt)
-	r.POST("/decrypt", cryptoController.Decrypt)
-	r.POST("/sign", cryptoController.Sign)
-	r.POST("/verify", cryptoController.Verify)
+	r.POST("/batch/encrypt", authorize(service.ScopeEncrypt), cryptoController.BatchEncrypt)
+	r.POST("/batch/decrypt", authorize(service.ScopeDecrypt), cryptoController.BatchDecrypt)
+	r.POST("/batch/sign", authorize(service.ScopeSign), cryptoController.BatchSign)
+	r.POST("/batch/verify", authorize(service.ScopeVerify), cryptoController.BatchVerify)
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"riot-api/controller"
+	"riot-api/service"
+	"riot-api/tools"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEnvFile = `
+SIGNING_KEY="first-signing-key"
+ENCRYPTION_ALGORITHM="aes-256-gcm"
+ENCRYPTION_KEY="bXBJWlhDOXVFc1RlN2Y5ZzFmWFhNc3BYbGlPQ1dOT2c="
+CORS_MAX_AGE="600"
+`
+
+// useEnvFile runs the test in a directory whose .env holds contents, loaded as at startup.
+func useEnvFile(t *testing.T, contents string) {
+	dir := t.TempDir()
+	writeEnvFile(t, dir, contents)
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	previousProcessEnv, previousEnvFile := processEnv, envFile
+	processEnv, envFile = make(map[string]bool), nil
+	t.Cleanup(func() {
+		applyEnvFile(nil)
+		processEnv, envFile = previousProcessEnv, previousEnvFile
+		os.Chdir(workingDir)
+	})
+
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		processEnv[name] = true
+	}
+	settings, err := readEnvFile()
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	applyEnvFile(settings)
+}
+
+func writeEnvFile(t *testing.T, dir string, contents string) {
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(contents), 0600); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+}
+
+// sign returns the body of a /sign response of cryptoController.
+func sign(cryptoController *controller.CryptoController) string {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/sign", cryptoController.Sign)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sign", strings.NewReader(`{"key1": "value1"}`)))
+	return w.Body.String()
+}
+
+func TestReloadKeys_Hangup(t *testing.T) {
+	// Prepare
+	useEnvFile(t, testEnvFile)
+	cryptoController := initCryptoController()
+	signature := sign(cryptoController)
+	writeEnvFile(t, ".", strings.Replace(testEnvFile, "first-signing-key", "second-signing-key", 1))
+
+	// Perform
+	err := reloadKeys(cryptoController, reloadOnHangup)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "second-signing-key", os.Getenv("SIGNING_KEY"))
+	assert.NotEqual(t, signature, sign(cryptoController))
+}
+
+func TestReloadKeys_RollsBackFailedKeys(t *testing.T) {
+	// Prepare: the new encryption key is too short to load
+	useEnvFile(t, testEnvFile)
+	cryptoController := initCryptoController()
+	signature := sign(cryptoController)
+	newEnvFile := strings.Replace(testEnvFile, "first-signing-key", "second-signing-key", 1)
+	writeEnvFile(t, ".", strings.Replace(newEnvFile, "bXBJWlhDOXVFc1RlN2Y5ZzFmWFhNc3BYbGlPQ1dOT2c=", "short", 1))
+
+	// Perform
+	err := reloadKeys(cryptoController, reloadOnHangup)
+
+	// Check: the previous settings are applied again, and the keys are unchanged
+	assert.ErrorContains(t, err, "encryption keys")
+	assert.Equal(t, "first-signing-key", os.Getenv("SIGNING_KEY"))
+	assert.Equal(t, "bXBJWlhDOXVFc1RlN2Y5ZzFmWFhNc3BYbGlPQ1dOT2c=", os.Getenv("ENCRYPTION_KEY"))
+	assert.Equal(t, signature, sign(cryptoController))
+}
+
+func TestReloadKeys_RejectedSettings(t *testing.T) {
+	// Prepare
+	useEnvFile(t, testEnvFile)
+	cryptoController := initCryptoController()
+	tests := map[string]struct {
+		envFile string
+		err     string
+	}{
+		"invalid":         {testEnvFile + `SIGNING_ALGORITHM="rot13"` + "\n", `SIGNING_ALGORITHM "rot13" is not supported`},
+		"startup only":    {strings.Replace(testEnvFile, `CORS_MAX_AGE="600"`, `CORS_MAX_AGE="60"`, 1), "CORS_MAX_AGE changed"},
+		"removed":         {strings.Replace(testEnvFile, `CORS_MAX_AGE="600"`, "", 1), "CORS_MAX_AGE changed"},
+		"keyring file":    {testEnvFile + `KEYRING_FILE="keyring.json"` + "\n", "KEYRING_FILE changed"},
+		"trusted proxy":   {testEnvFile + `TRUSTED_PROXIES="10.0.0.1"` + "\n", "TRUSTED_PROXIES changed"},
+		"decryption mode": {testEnvFile + `DECRYPT_MODE="passthrough"` + "\n", "DECRYPT_MODE changed"},
+	}
+
+	for name, test := range tests {
+		writeEnvFile(t, ".", strings.Replace(test.envFile, "first-signing-key", "second-signing-key", 1))
+
+		// Perform
+		err := reloadKeys(cryptoController, reloadOnHangup)
+
+		// Check: the environment is left untouched
+		assert.ErrorContains(t, err, test.err, name)
+		assert.Equal(t, "first-signing-key", os.Getenv("SIGNING_KEY"), name)
+		assert.Equal(t, "600", os.Getenv("CORS_MAX_AGE"), name)
+	}
+}
+
+func TestReloadKeys_ProcessEnvFirst(t *testing.T) {
+	// Prepare
+	t.Setenv("SIGNING_KEY", "process-signing-key")
+	useEnvFile(t, testEnvFile)
+	cryptoController := initCryptoController()
+	writeEnvFile(t, ".", strings.Replace(testEnvFile, "first-signing-key", "second-signing-key", 1))
+
+	// Perform
+	err := reloadKeys(cryptoController, reloadOnHangup)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "process-signing-key", os.Getenv("SIGNING_KEY"))
+}
+
+func TestReloadKeys_KeyringChangeKeepsEnv(t *testing.T) {
+	// Prepare
+	useEnvFile(t, testEnvFile)
+	cryptoController := initCryptoController()
+	writeEnvFile(t, ".", strings.Replace(testEnvFile, "first-signing-key", "second-signing-key", 1))
+
+	// Perform
+	err := reloadKeys(cryptoController, reloadOnKeyringChange)
+
+	// Check: only SIGHUP reads .env again
+	assert.NoError(t, err)
+	assert.Equal(t, "first-signing-key", os.Getenv("SIGNING_KEY"))
+}
+
+func TestSetupRouter_TrustedProxies(t *testing.T) {
+	// Prepare: without TRUSTED_PROXIES, or with 10.0.0.1 listed
+	useEnvFile(t, testEnvFile)
+	cryptoController := initCryptoController()
+	policy := service.RateLimitPolicy{Default: service.RateLimit{Rate: 1, Burst: 1}}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	newRouter := func(trustedProxies string) *gin.Engine {
+		t.Setenv("TRUSTED_PROXIES", trustedProxies)
+		return setupRouter(cryptoController, nil, tools.NewMemoryRateLimitStore(), policy, logger)
+	}
+	request := func(router *gin.Engine, remoteAddr string, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/sign", strings.NewReader(`{"key1": "value1"}`))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	untrusted := newRouter("")
+	trusted := newRouter("10.0.0.1")
+
+	// Perform
+	spoofedFirst := request(untrusted, "203.0.113.7:1234", "198.51.100.1")
+	spoofedSecond := request(untrusted, "203.0.113.7:1234", "198.51.100.2")
+	proxiedFirst := request(trusted, "10.0.0.1:1234", "198.51.100.1")
+	proxiedSecond := request(trusted, "10.0.0.1:1234", "198.51.100.2")
+
+	// Check: a new X-Forwarded-For only gets a new budget through a trusted proxy
+	assert.Equal(t, http.StatusOK, spoofedFirst)
+	assert.Equal(t, http.StatusTooManyRequests, spoofedSecond)
+	assert.Equal(t, http.StatusOK, proxiedFirst)
+	assert.Equal(t, http.StatusOK, proxiedSecond)
+}
+
+func TestReloadQueue_KeepsPendingHangup(t *testing.T) {
+	// Prepare
+	queue := newReloadQueue()
+
+	// Perform
+	queue.trigger(reloadOnKeyringChange)
+	queue.trigger(reloadOnHangup)
+	queue.trigger(reloadOnKeyringChange)
+	first := queue.next(0)
+	queue.trigger(reloadOnKeyringChange)
+	second := queue.next(0)
+
+	// Check
+	assert.Equal(t, reloadOnHangup, first)
+	assert.Equal(t, reloadOnKeyringChange, second)
+}
+
+func TestReloadQueue_MergesTriggers(t *testing.T) {
+	// Prepare
+	queue := newReloadQueue()
+	reasons := make(chan string, 2)
+	go func() {
+		for {
+			reasons <- queue.next(50 * time.Millisecond)
+		}
+	}()
+
+	// Perform: a SIGHUP arrives while a keyring file reload settles
+	queue.trigger(reloadOnKeyringChange)
+	time.Sleep(10 * time.Millisecond)
+	queue.trigger(reloadOnHangup)
+
+	// Check: a single reload, which covers the SIGHUP
+	assert.Equal(t, reloadOnHangup, <-reasons)
+	select {
+	case reason := <-reasons:
+		t.Fatalf("expected a single reload, but got another for %q", reason)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatchKeyringFile_Rename(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring.json")
+	os.WriteFile(path, []byte(`{}`), 0600)
+	reasons := make(chan string, 10)
+	watcher, err := watchKeyringFile(path, func(reason string) { reasons <- reason })
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	defer watcher.Close()
+
+	// Perform & Check: other files of the directory are ignored
+	os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{}`), 0600)
+	select {
+	case reason := <-reasons:
+		t.Fatalf("expected no reload, but got one for %q", reason)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Perform & Check: the keyring file is replaced by a rename, as editors do
+	os.WriteFile(filepath.Join(dir, "keyring.json.tmp"), []byte(`{"signing": {}}`), 0600)
+	os.Rename(filepath.Join(dir, "keyring.json.tmp"), path)
+	select {
+	case reason := <-reasons:
+		assert.Equal(t, reloadOnKeyringChange, reason)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload of the renamed keyring file")
+	}
+}
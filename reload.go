@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"riot-api/controller"
+	"riot-api/tools"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadSettleDelay lets editors finish writing the keyring file before it is read
+const reloadSettleDelay = 100 * time.Millisecond
+
+// Reasons of a reload
+const (
+	reloadOnHangup        = "SIGHUP"
+	reloadOnKeyringChange = "keyring file changed"
+)
+
+// startupSettings are only read at startup, so .env cannot change them on reload
+var startupSettings = []string{
+	"KEY_PROVIDER", "KEYRING_FILE", "DECRYPT_MODE", "BATCH_WORKERS", "API_KEYS_FILE",
+	"TLS_CERT", "TLS_KEY", "TLS_CLIENT_CA", "TRUSTED_PROXIES", "LOG_REDACT_FIELDS",
+	"RATE_LIMIT_STORE", "REDIS_URL", "RATE_LIMIT_FAILURE_MODE", "RATE_LIMITS_FILE",
+	"CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_METHODS", "CORS_ALLOWED_HEADERS", "CORS_ALLOW_CREDENTIALS", "CORS_MAX_AGE",
+}
+
+// watchKeyReloads reloads the keys on SIGHUP, after reading .env again, and whenever the keyring
+// file changes when KEY_PROVIDER=file. SIGHUP also reloads the API keys, if any. A failed reload
+// is logged and the current keys are kept.
+func watchKeyReloads(cryptoController *controller.CryptoController, apiKeys *tools.FileAPIKeyStore) {
+	reloads := newReloadQueue()
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			reloads.trigger(reloadOnHangup)
+		}
+	}()
+
+	if os.Getenv("KEY_PROVIDER") == "file" {
+		if _, err := watchKeyringFile(os.Getenv("KEYRING_FILE"), reloads.trigger); err != nil {
+			log.Printf("Not watching the keyring file: %v", err)
+		}
+	}
+
+	go func() {
+		for {
+			reason := reloads.next(reloadSettleDelay)
+			if err := reloadKeys(cryptoController, reason); err != nil {
+				log.Printf("Key reload (%s) failed, keeping the current keys: %v", reason, err)
+			} else {
+				log.Printf("Keys reloaded (%s)", reason)
+			}
+			if reason == reloadOnHangup && apiKeys != nil {
+				reloadAPIKeys(apiKeys)
+			}
+		}
+	}()
+}
+
+// reloadQueue merges the reload triggers received before a pending reload runs. As a SIGHUP
+// reload also does what a keyring file reload does, a pending SIGHUP is kept over any other reason.
+type reloadQueue struct {
+	mutex   sync.Mutex
+	pending string
+	ready   chan struct{}
+}
+
+func newReloadQueue() *reloadQueue {
+	return &reloadQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *reloadQueue) trigger(reason string) {
+	q.mutex.Lock()
+	if q.pending != reloadOnHangup {
+		q.pending = reason
+	}
+	q.mutex.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for a trigger, then for settle, and returns the reason of the pending reload.
+func (q *reloadQueue) next(settle time.Duration) string {
+	for {
+		<-q.ready
+		time.Sleep(settle)
+
+		q.mutex.Lock()
+		reason := q.pending
+		q.pending = ""
+		q.mutex.Unlock()
+		if reason != "" {
+			return reason
+		}
+	}
+}
+
+// watchKeyringFile watches the directory of the keyring file, so the file is still watched after
+// being replaced by a rename, as editors and secret managers do.
+func watchKeyringFile(path string, trigger func(reason string)) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(path) && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create)) {
+					trigger(reloadOnKeyringChange)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Keyring file watch error: %v", err)
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+// reloadKeys loads the keys into cryptoController, after applying .env again on SIGHUP. When it
+// fails, the current keys and settings are kept.
+func reloadKeys(cryptoController *controller.CryptoController, reason string) error {
+	restore := func() {}
+	if reason == reloadOnHangup {
+		settings, err := readEnvFile()
+		if err != nil {
+			return fmt.Errorf("reading .env: %w", err)
+		}
+		if err := checkEnvReload(settings); err != nil {
+			return err
+		}
+
+		previous := envFile
+		applyEnvFile(settings)
+		restore = func() { applyEnvFile(previous) }
+	}
+
+	signer, encryptor, keyWrapper, err := loadKeys()
+	if err != nil {
+		restore()
+		return err
+	}
+
+	cryptoController.Reload(signer, encryptor, keyWrapper)
+	return nil
+}
+
+// checkEnvReload validates the settings as they will be once those read from .env are applied,
+// leaving the environment untouched. It rejects the changes of settings only read at startup.
+func checkEnvReload(settings map[string]string) error {
+	getenv := func(name string) string {
+		if value, ok := settings[name]; ok {
+			return value
+		}
+		if _, ok := envFile[name]; ok {
+			return ""
+		}
+		return os.Getenv(name)
+	}
+	if err := validateSettings(getenv); err != nil {
+		return err
+	}
+
+	for _, name := range startupSettings {
+		if getenv(name) != os.Getenv(name) {
+			return fmt.Errorf("%s changed, which only applies after a restart", name)
+		}
+	}
+	return nil
+}
+
+func reloadAPIKeys(apiKeys *tools.FileAPIKeyStore) {
+	if err := apiKeys.Reload(); err != nil {
+		log.Printf("API key reload failed, keeping the current API keys: %v", err)
+		return
+	}
+	log.Printf("API keys reloaded")
+}
@@ -0,0 +1,40 @@
+package service
+
+import "errors"
+
+// API key scopes. Each scope grants the single and batch endpoints of one operation.
+const (
+	ScopeEncrypt = "encrypt"
+	ScopeDecrypt = "decrypt"
+	ScopeSign    = "sign"
+	ScopeVerify  = "verify"
+)
+
+// Scopes lists every scope an API key can be granted
+var Scopes = []string{ScopeEncrypt, ScopeDecrypt, ScopeSign, ScopeVerify}
+
+// ErrInvalidAPIKey is returned when an API key is missing or not known
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// Principal is the client an API key belongs to, along with the scopes it was granted.
+type Principal struct {
+	Name   string
+	Scopes []string
+}
+
+// HasScope reports whether the principal was granted the scope.
+func (p Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore authenticates API keys. Stores only keep hashes of the keys, so a leaked store
+// cannot be used to call the API.
+type APIKeyStore interface {
+	// Authenticate returns the principal of the key, or an error wrapping ErrInvalidAPIKey
+	Authenticate(key string) (Principal, error)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BatchResult is the outcome of one item of a batch
+type BatchResult struct {
+	Value interface{}
+	Err   error
+}
+
+// ProcessBatch calls process for every index below size on at most workers goroutines, and returns
+// the results in index order. An item that fails, or panics, only fails its own result.
+func ProcessBatch(size, workers int, process func(index int) (interface{}, error)) []BatchResult {
+	results := make([]BatchResult, size)
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > size {
+		workers = size
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = processItem(index, process)
+			}
+		}()
+	}
+
+	for index := 0; index < size; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+func processItem(index int, process func(index int) (interface{}, error)) (result BatchResult) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = BatchResult{Err: fmt.Errorf("item %d: %v", index, recovered)}
+		}
+	}()
+
+	value, err := process(index)
+	return BatchResult{Value: value, Err: err}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessBatch_KeepsOrder(t *testing.T) {
+	// Prepare
+	var running, maxRunning int32
+	process := func(index int) (interface{}, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			observed := atomic.LoadInt32(&maxRunning)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+				break
+			}
+		}
+		return index * 2, nil
+	}
+
+	// Perform
+	results := ProcessBatch(100, 4, process)
+
+	// Check
+	assert.Len(t, results, 100)
+	for index, result := range results {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, index*2, result.Value)
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(4))
+}
+
+func TestProcessBatch_IsolatesFailures(t *testing.T) {
+	// Prepare
+	process := func(index int) (interface{}, error) {
+		switch index {
+		case 1:
+			return nil, errors.New("failed")
+		case 2:
+			panic("boom")
+		}
+		return index, nil
+	}
+
+	// Perform
+	results := ProcessBatch(4, 2, process)
+
+	// Check
+	assert.Equal(t, 0, results[0].Value)
+	assert.EqualError(t, results[1].Err, "failed")
+	assert.EqualError(t, results[2].Err, "item 2: boom")
+	assert.Equal(t, 3, results[3].Value)
+}
+
+func TestProcessBatch_Empty(t *testing.T) {
+	// Perform
+	results := ProcessBatch(0, 4, func(index int) (interface{}, error) {
+		t.Fatalf("expected no item to be processed")
+		return nil, nil
+	})
+
+	// Check
+	assert.Empty(t, results)
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+)
+
+// MaxDepth bounds how deep EncryptOptions.Depth may walk into a document
+const MaxDepth = 32
+
+// EncryptOptions selects which values of a document are encrypted or decrypted.
+// By default every top-level value is: each value of an object, each element of an array, or the
+// document itself when it is a scalar.
+type EncryptOptions struct {
+	// Context is bound to every ciphertext along with its field name
+	Context string
+	// Selectors select the values to process, keeping the rest of the document readable
+	Selectors []Selector
+	// Depth walks into nested objects and arrays, processing the values found at that depth
+	// and any scalar found above it. Depths below 1 mean 1.
+	Depth int
+	// Deterministic selects values to encrypt deterministically. They are processed on their
+	// own, even when nested in a value otherwise processed as a whole.
+	Deterministic []Selector
+}
+
+func (o EncryptOptions) validate() error {
+	if len(o.Selectors) > 0 && o.Depth > 1 {
+		return errors.New("selectors and depth cannot be combined")
+	}
+	if o.Depth > MaxDepth {
+		return errors.New("depth must not exceed " + strconv.Itoa(MaxDepth))
+	}
+	return nil
+}
+
+func (o EncryptOptions) isDefault() bool {
+	return len(o.Selectors) == 0 && o.Depth <= 1 && len(o.Deterministic) == 0
+}
+
+// transformFunc returns the replacement of the value found at path. deterministic reports whether
+// the value was selected by EncryptOptions.Deterministic.
+type transformFunc func(path []string, value interface{}, deterministic bool) (interface{}, error)
+
+// documentTransform applies a transformFunc to a document, splitting the values that contain a
+// deterministic value so that one is processed on its own.
+type documentTransform struct {
+	deterministic [][]string
+	transform     transformFunc
+}
+
+// transformDocument returns a copy of data where the values selected by options are replaced by
+// transform. data itself is not modified.
+func transformDocument(data interface{}, options EncryptOptions, transform transformFunc) (interface{}, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	t := documentTransform{deterministic: selectedPaths(data, options.Deterministic), transform: transform}
+
+	if len(options.Selectors) == 0 {
+		depth := options.Depth
+		if depth < 1 {
+			depth = 1
+		}
+		return t.toDepth(data, nil, depth)
+	}
+
+	selectors := append(append([]Selector{}, options.Selectors...), options.Deterministic...)
+	document := copyDocument(data)
+	for _, path := range selectedPaths(data, selectors) {
+		if err := transformAt(document, path, func(path []string, value interface{}) (interface{}, error) {
+			return t.toDepth(value, path, len(path))
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return document, nil
+}
+
+func (t documentTransform) toDepth(value interface{}, path []string, depth int) (interface{}, error) {
+	if t.isDeterministic(path) {
+		return t.transform(path, value, true)
+	}
+	if len(path) >= depth && !t.containsDeterministic(path) {
+		return t.transform(path, value, false)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			transformed, err := t.toDepth(child, childPath(path, key), depth)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = transformed
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, child := range v {
+			transformed, err := t.toDepth(child, childPath(path, strconv.Itoa(i)), depth)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = transformed
+		}
+		return result, nil
+
+	default:
+		return t.transform(path, value, false)
+	}
+}
+
+func (t documentTransform) isDeterministic(path []string) bool {
+	for _, deterministic := range t.deterministic {
+		if len(deterministic) == len(path) && isPrefix(deterministic, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsDeterministic reports whether a deterministic value is nested in the value at path.
+func (t documentTransform) containsDeterministic(path []string) bool {
+	for _, deterministic := range t.deterministic {
+		if len(deterministic) > len(path) && isPrefix(path, deterministic) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedPaths returns the distinct paths selected in document. When both a value and one of its
+// descendants are selected, only the value is kept, so nothing is processed twice.
+func selectedPaths(document interface{}, selectors []Selector) [][]string {
+	var paths [][]string
+	seen := make(map[string]bool)
+	for _, selector := range selectors {
+		for _, path := range selector.matches(document) {
+			pointer := FieldName(path) + "\x00" + strconv.Itoa(len(path))
+			if !seen[pointer] {
+				seen[pointer] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	var result [][]string
+	for _, path := range paths {
+		covered := false
+		for _, other := range paths {
+			if len(other) < len(path) && isPrefix(other, path) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			result = append(result, path)
+		}
+	}
+	return result
+}
+
+func isPrefix(prefix, path []string) bool {
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// transformAt replaces the value found at path in document, which must exist.
+func transformAt(document interface{}, path []string, transform func(path []string, value interface{}) (interface{}, error)) error {
+	parent := document
+	for _, token := range path[:len(path)-1] {
+		parent = child(parent, token)
+	}
+
+	last := path[len(path)-1]
+	transformed, err := transform(path, child(parent, last))
+	if err != nil {
+		return err
+	}
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = transformed
+	case []interface{}:
+		index, _ := strconv.Atoi(last)
+		p[index] = transformed
+	}
+	return nil
+}
+
+// documentBinding returns the binding of the value found at path in document, walking the document
+// to tell array indexes from object keys.
+func documentBinding(document interface{}, path []string, context string) Binding {
+	tokens := make([]interface{}, len(path))
+	value := document
+	for i, token := range path {
+		if _, ok := value.([]interface{}); ok {
+			tokens[i], _ = strconv.Atoi(token)
+		} else {
+			tokens[i] = token
+		}
+		value = child(value, token)
+	}
+	return Binding{Field: FieldName(path), Path: tokens, Context: context}
+}
+
+func child(value interface{}, token string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v[token]
+	case []interface{}:
+		index, _ := strconv.Atoi(token)
+		return v[index]
+	}
+	return nil
+}
+
+// copyDocument deep copies the objects and arrays of a decoded JSON document.
+func copyDocument(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			result[key] = copyDocument(child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, child := range v {
+			result[i] = copyDocument(child)
+		}
+		return result
+	default:
+		return value
+	}
+}
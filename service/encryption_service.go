@@ -1,9 +1,143 @@
 package service
 
-func EncryptPayload(encryptor Encryptor, data map[string]interface{}) (map[string]interface{}, error) {
-	return encryptor.Encrypt(data)
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Decryption modes of /decrypt
+const (
+	// DecryptModeStrict fails when any value is not a ciphertext
+	DecryptModeStrict = "strict"
+	// DecryptModePassthrough returns values that are not recognised ciphertexts unchanged
+	DecryptModePassthrough = "passthrough"
+)
+
+// ErrObjectRequired is returned when an encryptor that only handles objects is given an array or a
+// scalar
+var ErrObjectRequired = errors.New("only objects are supported")
+
+// EncryptPayload encrypts the values of the document selected by options, every top-level value by
+// default. The document may be an object, an array, whose elements are treated like top-level
+// values named by their index, or a scalar, which is encrypted as a whole. Each ciphertext is bound
+// to its field name and the optional context. Values selected by options.Deterministic are
+// encrypted deterministically.
+func EncryptPayload(encryptor Encryptor, data interface{}, options EncryptOptions) (interface{}, error) {
+	valueEncryptor, ok := encryptor.(ValueEncryptor)
+	if !ok {
+		if !options.isDefault() || options.Context != "" {
+			return nil, errors.New("encryption options are not supported")
+		}
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, ErrObjectRequired
+		}
+		return encryptor.Encrypt(object)
+	}
+
+	deterministicEncryptor, ok := encryptor.(DeterministicEncryptor)
+	if !ok && len(options.Deterministic) > 0 {
+		return nil, ErrDeterministicUnsupported
+	}
+
+	return transformDocument(data, options, func(path []string, value interface{}, deterministic bool) (interface{}, error) {
+		binding := documentBinding(data, path, options.Context)
+		if deterministic {
+			return deterministicEncryptor.EncryptValueDeterministically(binding, value)
+		}
+		return valueEncryptor.EncryptValue(binding, value)
+	})
+}
+
+// DecryptPayload decrypts the values of the document selected by options, every top-level value by
+// default, with the context they were encrypted with.
+func DecryptPayload(encryptor Encryptor, data interface{}, options EncryptOptions) (interface{}, error) {
+	valueEncryptor, ok := encryptor.(ValueEncryptor)
+	if !ok {
+		if !options.isDefault() || options.Context != "" {
+			return nil, errors.New("encryption options are not supported")
+		}
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, ErrObjectRequired
+		}
+		return encryptor.Decrypt(object)
+	}
+
+	return transformDocument(data, options, func(path []string, value interface{}, _ bool) (interface{}, error) {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: values must be strings", ErrInvalidCiphertext)
+		}
+		return valueEncryptor.DecryptValue(documentBinding(data, path, options.Context), str)
+	})
+}
+
+// DecryptRecognizedPayload decrypts the selected values the encryptor recognises as its
+// ciphertexts and returns every other value unchanged, along with the sorted field names that
+// were decrypted. A scalar document has no field name, so decrypting it reports none.
+func DecryptRecognizedPayload(encryptor Encryptor, data interface{}, options EncryptOptions) (interface{}, []string, error) {
+	valueEncryptor, ok := encryptor.(ValueEncryptor)
+	if !ok {
+		return nil, nil, errors.New("pass-through decryption is not supported")
+	}
+
+	decryptedKeys := []string{}
+	decryptedData, err := transformDocument(data, options, func(path []string, value interface{}, _ bool) (interface{}, error) {
+		str, ok := value.(string)
+		if !ok || !valueEncryptor.Recognizes(str) {
+			return value, nil
+		}
+
+		binding := documentBinding(data, path, options.Context)
+		plaintext, err := valueEncryptor.DecryptValue(binding, str)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) > 0 {
+			decryptedKeys = append(decryptedKeys, binding.Field)
+		}
+		return plaintext, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(decryptedKeys)
+	return decryptedData, decryptedKeys, nil
 }
 
-func DecryptPayload(encryptor Encryptor, data map[string]interface{}) (map[string]interface{}, error) {
-	return encryptor.Decrypt(data)
+// EncryptValues encrypts every value of the object at a depth of 1, binding each ciphertext to
+// its key and the context.
+func EncryptValues(encryptor ValueEncryptor, data map[string]interface{}, context string) (map[string]interface{}, error) {
+	encryptedData := make(map[string]interface{})
+
+	for key, value := range data {
+		ciphertext, err := encryptor.EncryptValue(KeyBinding(key, context), value)
+		if err != nil {
+			return nil, err
+		}
+		encryptedData[key] = ciphertext
+	}
+	return encryptedData, nil
+}
+
+// DecryptValues decrypts every value of the object at a depth of 1.
+func DecryptValues(encryptor ValueEncryptor, data map[string]interface{}, context string) (map[string]interface{}, error) {
+	decryptedData := make(map[string]interface{})
+
+	for key, value := range data {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: values must be strings", ErrInvalidCiphertext)
+		}
+
+		plaintext, err := encryptor.DecryptValue(KeyBinding(key, context), str)
+		if err != nil {
+			return nil, err
+		}
+		decryptedData[key] = plaintext
+	}
+	return decryptedData, nil
 }
@@ -1,6 +1,89 @@
 package service
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownKey is returned when a value was produced with a key that is not configured
+var ErrUnknownKey = errors.New("unknown key")
+
+// UnknownKeyError names the key a ciphertext was produced with, which is not configured. It
+// matches ErrUnknownKey.
+type UnknownKeyError struct {
+	KeyID string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("%v %q", ErrUnknownKey, e.KeyID)
+}
+
+func (e *UnknownKeyError) Is(target error) bool {
+	return target == ErrUnknownKey
+}
+
+// ErrInvalidCiphertext is returned when a value to decrypt is not a ciphertext: a malformed
+// envelope, an undecodable payload, or an algorithm or version that is not supported
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// ErrAuthenticationFailed is returned when a ciphertext fails authentication: it was tampered
+// with, encrypted under another key, or moved from another field or context
+var ErrAuthenticationFailed = errors.New("message authentication failed")
+
 type Encryptor interface {
 	Encrypt(data map[string]interface{}) (map[string]interface{}, error)
 	Decrypt(data map[string]interface{}) (map[string]interface{}, error)
 }
+
+// Binding identifies where an encrypted value belongs. Authenticated encryptors bind it to the
+// ciphertext, so a ciphertext moved to another field or record fails to decrypt.
+type Binding struct {
+	// Field is the JSON key holding a top-level value, or the JSON Pointer of a nested one, used to
+	// report the value. It cannot tell a top-level key containing "/" from a nested value, nor an
+	// array index from an object key, so ciphertexts are bound to Path instead.
+	Field string
+	// Path lists the object keys, as strings, and array indexes, as ints, leading to the value
+	Path []interface{}
+	// Context is an optional caller-supplied string, such as a tenant or record ID
+	Context string
+}
+
+// KeyBinding returns the binding of the value held by key in a top-level object.
+func KeyBinding(key string, context string) Binding {
+	return Binding{Field: key, Path: []interface{}{key}, Context: context}
+}
+
+// ValueEncryptor encrypts single values into self-describing envelopes, so the encryptor that
+// produced a value can be recognised when decrypting it.
+type ValueEncryptor interface {
+	Algorithm() string
+	EncryptValue(binding Binding, value interface{}) (string, error)
+	DecryptValue(binding Binding, ciphertext string) (interface{}, error)
+	// Recognizes reports whether ciphertext is an envelope this encryptor can decrypt
+	Recognizes(ciphertext string) bool
+}
+
+// ErrDeterministicUnsupported is returned when deterministic encryption is requested from an
+// encryptor that cannot provide it
+var ErrDeterministicUnsupported = errors.New("deterministic encryption is not configured")
+
+// DeterministicEncryptor can also encrypt values deterministically: the same value, key and
+// binding always give the same ciphertext, so encrypted values can be looked up and joined on
+// without being decrypted. This reveals which values are equal.
+type DeterministicEncryptor interface {
+	ValueEncryptor
+	EncryptValueDeterministically(binding Binding, value interface{}) (string, error)
+}
+
+// KeyWrapper implements envelope encryption: each payload is encrypted under a fresh data key,
+// which is returned wrapped under a long-lived master key. Rotating the master key then only
+// requires rewrapping data keys, never re-encrypting payloads.
+type KeyWrapper interface {
+	// NewDataKey returns an encryptor using a fresh data key, and that key wrapped under the
+	// active master key
+	NewDataKey() (Encryptor, string, error)
+	// OpenDataKey unwraps a data key and returns an encryptor using it
+	OpenDataKey(wrappedKey string) (Encryptor, error)
+	// Rewrap wraps a data key under the active master key, without exposing it
+	Rewrap(wrappedKey string) (string, error)
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// DecodeJSON decodes a single JSON document into v, keeping numbers as json.Number so integers
+// above 2^53 and high-precision decimals come back exactly as they were written.
+func DecodeJSON(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
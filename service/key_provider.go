@@ -0,0 +1,31 @@
+package service
+
+import "errors"
+
+// Key purposes. Key IDs are unique within a purpose only.
+const (
+	PurposeSigning    = "signing"
+	PurposeEncryption = "encryption"
+)
+
+// ErrNoActiveKey is returned when no key is configured for a purpose
+var ErrNoActiveKey = errors.New("no active key")
+
+// Key is key material as stored by a KeyProvider: the text of an HMAC secret, a hex or base64
+// encoded encryption key, or an encoded private key. Consumers decode it for their algorithm.
+type Key struct {
+	ID       string
+	Purpose  string
+	Material []byte
+}
+
+// KeyProvider is the only source of key material. Each purpose has one active key, used to sign
+// and encrypt, and any number of retired keys still used to verify and decrypt.
+type KeyProvider interface {
+	// GetKey returns the key of the purpose with the given ID, or an error wrapping ErrUnknownKey
+	GetKey(purpose string, id string) (Key, error)
+	// ActiveKey returns the active key of the purpose, or an error wrapping ErrNoActiveKey
+	ActiveKey(purpose string) (Key, error)
+	// ListKeys returns every key of the purpose, the active one included, sorted by ID
+	ListKeys(purpose string) ([]Key, error)
+}
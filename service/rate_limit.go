@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimit is a token bucket: up to Burst requests at once, refilled at Rate requests per second.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// DefaultRateLimit applies to the requests no other limit of the policy applies to
+var DefaultRateLimit = RateLimit{Rate: 1000, Burst: 1000}
+
+// RateLimitPolicy chooses the limit of a request from the identity of its caller and its route.
+// The most specific limit applies: the identity's for the route, the route's, the identity's
+// default, and finally Default. Routes with a limit of their own have their own budget, while the
+// other routes share the budget of the caller.
+type RateLimitPolicy struct {
+	Default    RateLimit
+	Routes     map[string]RateLimit
+	Identities map[string]IdentityRateLimits
+}
+
+// IdentityRateLimits are the limits of one identity, overriding those of the policy
+type IdentityRateLimits struct {
+	Default *RateLimit           `json:"default,omitempty"`
+	Routes  map[string]RateLimit `json:"routes,omitempty"`
+}
+
+// Limit returns the limit of a request by the identity to the route, and whether the route has a
+// budget of its own.
+func (p RateLimitPolicy) Limit(identity, route string) (RateLimit, bool) {
+	limits := p.Identities[identity]
+	if limit, ok := limits.Routes[route]; ok {
+		return limit, true
+	}
+	if limit, ok := p.Routes[route]; ok {
+		return limit, true
+	}
+	if limits.Default != nil {
+		return *limits.Default, false
+	}
+	return p.Default, false
+}
+
+// RateLimitResult is the outcome of taking one request from a budget.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of requests still allowed right away
+	Remaining int
+	// RetryAfter is the time until the next request is allowed, when this one was not
+	RetryAfter time.Duration
+	// Reset is the time until the budget is full again
+	Reset time.Duration
+}
+
+// RateLimitStore keeps the budget of each key. Replicas sharing a store share their budgets.
+type RateLimitStore interface {
+	// Take takes one request from the budget of the key, which is created full
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
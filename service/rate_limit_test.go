@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitPolicy_Limit(t *testing.T) {
+	// Prepare
+	policy := RateLimitPolicy{
+		Default: RateLimit{Rate: 100, Burst: 100},
+		Routes:  map[string]RateLimit{"/decrypt": {Rate: 10, Burst: 10}},
+		Identities: map[string]IdentityRateLimits{
+			"api-key:billing":  {Default: &RateLimit{Rate: 500, Burst: 500}, Routes: map[string]RateLimit{"/decrypt": {Rate: 50, Burst: 50}}},
+			"api-key:frontend": {Default: &RateLimit{Rate: 200, Burst: 200}},
+		},
+	}
+
+	tests := map[string]struct {
+		identity  string
+		route     string
+		limit     RateLimit
+		ownBudget bool
+	}{
+		"default":                  {"ip:10.0.0.1", "/verify", RateLimit{Rate: 100, Burst: 100}, false},
+		"route":                    {"ip:10.0.0.1", "/decrypt", RateLimit{Rate: 10, Burst: 10}, true},
+		"identity":                 {"api-key:billing", "/verify", RateLimit{Rate: 500, Burst: 500}, false},
+		"identity route":           {"api-key:billing", "/decrypt", RateLimit{Rate: 50, Burst: 50}, true},
+		"route over identity":      {"api-key:frontend", "/decrypt", RateLimit{Rate: 10, Burst: 10}, true},
+		"identity without a route": {"api-key:frontend", "/sign", RateLimit{Rate: 200, Burst: 200}, false},
+	}
+
+	for name, test := range tests {
+		// Perform
+		limit, ownBudget := policy.Limit(test.identity, test.route)
+
+		// Check
+		assert.Equal(t, test.limit, limit, name)
+		assert.Equal(t, test.ownBudget, ownBudget, name)
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Selector selects values of a JSON document. It is parsed from a JSONPath expression
+// ($.user.ssn, $.cards[*].pan, $['a key'][0]) or a JSON Pointer (/user/ssn, /cards/0/pan).
+//
+// Only child, index and wildcard segments are supported, not recursive descent or filters.
+type Selector struct {
+	expression string
+	segments   []segment
+}
+
+type segment struct {
+	key      string
+	hasKey   bool
+	index    int
+	wildcard bool
+}
+
+func ParseSelector(expression string) (Selector, error) {
+	var segments []segment
+	var err error
+
+	switch {
+	case strings.HasPrefix(expression, "$"):
+		segments, err = parseJSONPath(expression[1:])
+	case strings.HasPrefix(expression, "/"):
+		segments = parseJSONPointer(expression[1:])
+	default:
+		err = errors.New("selector must be a JSONPath starting with $ or a JSON Pointer starting with /")
+	}
+	if err != nil {
+		return Selector{}, fmt.Errorf("invalid selector %q: %w", expression, err)
+	}
+	if len(segments) == 0 {
+		return Selector{}, fmt.Errorf("invalid selector %q: selector must not select the whole document", expression)
+	}
+
+	return Selector{expression: expression, segments: segments}, nil
+}
+
+// ParseSelectors parses a list of expressions, see ParseSelector.
+func ParseSelectors(expressions []string) ([]Selector, error) {
+	selectors := make([]Selector, 0, len(expressions))
+	for _, expression := range expressions {
+		selector, err := ParseSelector(expression)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func (s Selector) String() string {
+	return s.expression
+}
+
+func parseJSONPath(path string) ([]segment, error) {
+	var segments []segment
+
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			if strings.HasPrefix(path, ".") {
+				return nil, errors.New("recursive descent is not supported")
+			}
+			if strings.HasPrefix(path, "*") {
+				segments = append(segments, segment{wildcard: true, index: -1})
+				path = path[1:]
+				continue
+			}
+
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			if end == 0 {
+				return nil, errors.New("empty member name")
+			}
+			segments = append(segments, segment{key: path[:end], hasKey: true, index: -1})
+			path = path[end:]
+
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, errors.New("unterminated bracket")
+			}
+			inner := path[1:end]
+
+			switch {
+			case inner == "*":
+				segments = append(segments, segment{wildcard: true, index: -1})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, segment{key: inner[1 : len(inner)-1], hasKey: true, index: -1})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid index %q", inner)
+				}
+				segments = append(segments, segment{index: index})
+			}
+			path = path[end+1:]
+
+		default:
+			return nil, fmt.Errorf("unexpected character %q", path[0])
+		}
+	}
+	return segments, nil
+}
+
+func parseJSONPointer(pointer string) []segment {
+	var segments []segment
+
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		// A pointer token selects an object member, or an array element when it is a number
+		seg := segment{key: token, hasKey: true, index: -1}
+		if index, err := strconv.Atoi(token); err == nil && index >= 0 && strconv.Itoa(index) == token {
+			seg.index = index
+		}
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+// matches returns the paths of the values the selector selects in document.
+func (s Selector) matches(document interface{}) [][]string {
+	var paths [][]string
+	s.match(document, s.segments, nil, &paths)
+	return paths
+}
+
+func (s Selector) match(value interface{}, segments []segment, path []string, paths *[][]string) {
+	if len(segments) == 0 {
+		*paths = append(*paths, path)
+		return
+	}
+
+	seg := segments[0]
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if seg.wildcard {
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				s.match(v[key], segments[1:], childPath(path, key), paths)
+			}
+		} else if child, ok := v[seg.key]; ok && seg.hasKey {
+			s.match(child, segments[1:], childPath(path, seg.key), paths)
+		}
+
+	case []interface{}:
+		if seg.wildcard {
+			for i, child := range v {
+				s.match(child, segments[1:], childPath(path, strconv.Itoa(i)), paths)
+			}
+		} else if seg.index >= 0 && seg.index < len(v) {
+			s.match(v[seg.index], segments[1:], childPath(path, strconv.Itoa(seg.index)), paths)
+		}
+	}
+}
+
+// childPath returns a copy of path extended with token, so sibling paths never share storage.
+func childPath(path []string, token string) []string {
+	child := make([]string, len(path), len(path)+1)
+	copy(child, path)
+	return append(child, token)
+}
+
+// FieldName names the value found at path for reporting: the key itself for
+// top-level values, and a JSON Pointer for nested values.
+func FieldName(path []string) string {
+	if len(path) == 1 {
+		return path[0]
+	}
+
+	var pointer strings.Builder
+	for _, token := range path {
+		pointer.WriteByte('/')
+		pointer.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return pointer.String()
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeDocument(t *testing.T, document string) map[string]interface{} {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(document), &data); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return data
+}
+
+func TestParseSelector_Matches(t *testing.T) {
+	// Prepare
+	document := decodeDocument(t, `{"user": {"ssn": "1", "a/b": "2"}, "cards": [{"pan": "3"}, {"pan": "4"}], "a key": ["5"]}`)
+
+	tests := map[string][]string{
+		"$.user.ssn":      {"/user/ssn"},
+		"$.cards[*].pan":  {"/cards/0/pan", "/cards/1/pan"},
+		"$.cards[1].pan":  {"/cards/1/pan"},
+		"$.user.*":        {"/user/a~1b", "/user/ssn"},
+		"$['a key'][0]":   {"/a key/0"},
+		"/user/ssn":       {"/user/ssn"},
+		"/user/a~1b":      {"/user/a~1b"},
+		"/cards/0/pan":    {"/cards/0/pan"},
+		"$.user.missing":  nil,
+		"$.cards[5].pan":  nil,
+		"$.user.ssn.deep": nil,
+	}
+
+	for expression, expected := range tests {
+		// Perform
+		selector, err := ParseSelector(expression)
+
+		// Check
+		assert.NoError(t, err, expression)
+		var names []string
+		for _, path := range selector.matches(document) {
+			names = append(names, FieldName(path))
+		}
+		assert.Equal(t, expected, names, expression)
+	}
+}
+
+func TestParseSelector_Invalid(t *testing.T) {
+	for _, expression := range []string{"", "user.ssn", "$", "$..ssn", "$.", "$.cards[", "$.cards[-1]", "$.cards[x]", "$user"} {
+		// Perform
+		_, err := ParseSelector(expression)
+
+		// Check
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestTransformDocument_Selectors(t *testing.T) {
+	// Prepare
+	data := decodeDocument(t, `{"user": {"ssn": "1", "name": "Ann"}, "id": 7}`)
+	selectors, _ := ParseSelectors([]string{"$.user.ssn", "$.user", "/user/name"})
+	var fields []string
+
+	// Perform
+	result, err := transformDocument(data, EncryptOptions{Selectors: selectors}, func(path []string, value interface{}, _ bool) (interface{}, error) {
+		fields = append(fields, FieldName(path))
+		return "x", nil
+	})
+
+	// Check: the selected ancestor wins over its descendants, the input is left untouched
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user"}, fields)
+	assert.Equal(t, map[string]interface{}{"user": "x", "id": float64(7)}, result)
+	assert.Equal(t, "1", data["user"].(map[string]interface{})["ssn"])
+}
+
+func TestTransformDocument_Depth(t *testing.T) {
+	// Prepare
+	data := decodeDocument(t, `{"user": {"ssn": "1", "address": {"city": "Paris"}}, "tags": ["a", "b"], "id": 7}`)
+	var fields []string
+
+	// Perform
+	_, err := transformDocument(data, EncryptOptions{Depth: 2}, func(path []string, value interface{}, _ bool) (interface{}, error) {
+		fields = append(fields, FieldName(path))
+		return value, nil
+	})
+
+	// Check
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"/user/ssn", "/user/address", "/tags/0", "/tags/1", "id"}, fields)
+}
+
+func TestDocumentBinding_Selectors(t *testing.T) {
+	// Prepare: a top-level key spelling the pointer of a nested value
+	data := decodeDocument(t, `{"/a/b": "1", "a": {"b": "2"}, "cards": [{"pan": "3"}]}`)
+	selectors, _ := ParseSelectors([]string{"$['/a/b']", "$.a.b", "$.cards[*].pan"})
+	paths := make(map[string][]interface{})
+
+	// Perform
+	_, err := transformDocument(data, EncryptOptions{Selectors: selectors}, func(path []string, value interface{}, _ bool) (interface{}, error) {
+		paths[value.(string)] = documentBinding(data, path, "").Path
+		return value, nil
+	})
+
+	// Check: both have the field name /a/b, but not the same path
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]interface{}{
+		"1": {"/a/b"},
+		"2": {"a", "b"},
+		"3": {"cards", 0, "pan"},
+	}, paths)
+}
+
+func TestTransformDocument_InvalidOptions(t *testing.T) {
+	// Prepare
+	selectors, _ := ParseSelectors([]string{"$.user"})
+	identity := func(path []string, value interface{}, _ bool) (interface{}, error) { return value, nil }
+
+	for _, options := range []EncryptOptions{{Selectors: selectors, Depth: 2}, {Depth: MaxDepth + 1}} {
+		// Perform
+		_, err := transformDocument(map[string]interface{}{}, options, identity)
+
+		// Check
+		assert.Error(t, err)
+	}
+}
+
+func TestTransformDocument_Deterministic(t *testing.T) {
+	// Prepare
+	data := decodeDocument(t, `{"user": {"email": "a@b.c", "name": "Ann"}, "id": 7}`)
+	deterministic, _ := ParseSelectors([]string{"$.user.email"})
+	fields := make(map[string]bool)
+
+	// Perform
+	_, err := transformDocument(data, EncryptOptions{Deterministic: deterministic}, func(path []string, value interface{}, deterministic bool) (interface{}, error) {
+		fields[FieldName(path)] = deterministic
+		return value, nil
+	})
+
+	// Check: the object holding the deterministic value is split instead of processed whole
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/user/email": true, "/user/name": false, "id": false}, fields)
+}
+
+func TestTransformDocument_ArraysAndScalars(t *testing.T) {
+	// Prepare
+	var array interface{}
+	json.Unmarshal([]byte(`[{"ssn": "1", "name": "Ann"}, "b"]`), &array)
+	selectors, _ := ParseSelectors([]string{"$[*].ssn"})
+	record := func(fields *[]string) transformFunc {
+		return func(path []string, value interface{}, _ bool) (interface{}, error) {
+			*fields = append(*fields, FieldName(path))
+			return "x", nil
+		}
+	}
+	var byDefault, selected, scalar []string
+
+	// Perform
+	defaultResult, errDefault := transformDocument(array, EncryptOptions{}, record(&byDefault))
+	selectedResult, errSelected := transformDocument(array, EncryptOptions{Selectors: selectors}, record(&selected))
+	scalarResult, errScalar := transformDocument("value", EncryptOptions{}, record(&scalar))
+
+	// Check: elements are processed like top-level values, a scalar as a whole
+	assert.NoError(t, errDefault)
+	assert.Equal(t, []string{"0", "1"}, byDefault)
+	assert.Equal(t, []interface{}{"x", "x"}, defaultResult)
+
+	assert.NoError(t, errSelected)
+	assert.Equal(t, []string{"/0/ssn"}, selected)
+	assert.Equal(t, []interface{}{map[string]interface{}{"ssn": "x", "name": "Ann"}, "b"}, selectedResult)
+
+	assert.NoError(t, errScalar)
+	assert.Equal(t, []string{""}, scalar)
+	assert.Equal(t, "x", scalarResult)
+}
+
+func TestDocumentBinding_ArraysAndScalars(t *testing.T) {
+	// Prepare
+	var array interface{}
+	json.Unmarshal([]byte(`["a", {"0": "b"}]`), &array)
+
+	// Perform
+	element := documentBinding(array, []string{"0"}, "")
+	key := documentBinding(array, []string{"1", "0"}, "")
+	scalar := documentBinding("value", nil, "")
+
+	// Check: an index and a key spelled alike are told apart
+	assert.Equal(t, []interface{}{0}, element.Path)
+	assert.Equal(t, "0", element.Field)
+	assert.Equal(t, []interface{}{1, "0"}, key.Path)
+	assert.Empty(t, scalar.Path)
+}
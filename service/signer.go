@@ -1,6 +1,38 @@
 package service
 
+// Reasons reported by a failed signature verification
+const (
+	ReasonMalformedSignature = "malformed_signature"
+	ReasonMismatch           = "mismatch"
+	ReasonUnknownKey         = "unknown_key"
+	ReasonInvalidData        = "invalid_data"
+)
+
+// Signer signs the canonical form of a decoded JSON document, which may be an object, an array or
+// a scalar.
 type Signer interface {
-	Sign(data map[string]interface{}) (string, error)
-	Verify(data map[string]interface{}, signature string) (bool, error)
+	Sign(data interface{}) (string, error)
+	Verify(data interface{}, signature string) (VerificationResult, error)
+}
+
+// VerificationResult describes the outcome of a signature verification.
+// Reason is empty when the signature is valid.
+type VerificationResult struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason,omitempty"`
+	KeyID  string `json:"key_id,omitempty"`
+}
+
+// PublicKey is the PEM encoded PKIX public key of a signing key.
+type PublicKey struct {
+	KeyID string
+	PEM   string
+}
+
+// PublicKeyExporter is implemented by asymmetric signers, whose signatures third parties can
+// verify with the public key alone.
+type PublicKeyExporter interface {
+	Algorithm() string
+	// PublicKeys returns the public key of the active key first, then those of the retired keys
+	PublicKeys() ([]PublicKey, error)
 }
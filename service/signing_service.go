@@ -1,13 +1,13 @@
 package service
 
-func SignPayload(signer Signer, data map[string]interface{}) (string, error) {
+func SignPayload(signer Signer, data interface{}) (string, error) {
 	return signer.Sign(data)
 }
 
-func VerifySignature(signer Signer, data map[string]interface{}, providedSignature string) bool {
-	verified, err := signer.Verify(data, providedSignature)
-	if verified && err == nil {
-		return true
+func VerifySignature(signer Signer, data interface{}, providedSignature string) VerificationResult {
+	result, err := signer.Verify(data, providedSignature)
+	if err != nil {
+		return VerificationResult{Reason: ReasonInvalidData}
 	}
-	return false
+	return result
 }
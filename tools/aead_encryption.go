@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"riot-api/service"
+)
+
+// aeadEncryptor encrypts values into envelopes with an AEAD cipher, authenticated along with
+// their binding. The payload is the random nonce followed by the sealed value.
+type aeadEncryptor struct {
+	algorithm string
+	activeID  string
+	aeads     map[string]cipher.AEAD
+}
+
+func newAEADEncryptor(algorithm string, keyring *Keyring, newAEAD func(key []byte) (cipher.AEAD, error)) (*aeadEncryptor, error) {
+	aeads := make(map[string]cipher.AEAD)
+	for _, id := range keyring.IDs() {
+		key, _ := keyring.Key(id)
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		aeads[id] = aead
+	}
+
+	return &aeadEncryptor{algorithm: algorithm, activeID: keyring.ActiveID(), aeads: aeads}, nil
+}
+
+func (e *aeadEncryptor) Encrypt(data map[string]interface{}) (map[string]interface{}, error) {
+	return service.EncryptValues(e, data, "")
+}
+
+func (e *aeadEncryptor) Decrypt(data map[string]interface{}) (map[string]interface{}, error) {
+	return service.DecryptValues(e, data, "")
+}
+
+func (e *aeadEncryptor) Algorithm() string {
+	return e.algorithm
+}
+
+// EncryptValue encrypts the value into an envelope, authenticated along with its binding.
+func (e *aeadEncryptor) EncryptValue(binding service.Binding, value interface{}) (string, error) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.New("failed to encrypt data")
+	}
+
+	return e.seal(jsonData, associatedData(binding))
+}
+
+// DecryptValue decrypts envelopes with their binding. Values produced before envelopes existed
+// were not bound to anything.
+func (e *aeadEncryptor) DecryptValue(binding service.Binding, ciphertext string) (interface{}, error) {
+	var plaintext []byte
+	var err error
+
+	if IsEnvelope(ciphertext) {
+		envelope, envelopeErr := openEnvelope(e.algorithm, ciphertext)
+		if envelopeErr != nil {
+			return nil, envelopeErr
+		}
+
+		plaintext, err = e.open(envelope.KeyID, envelope.Payload, associatedData(binding))
+	} else {
+		keyID, payload := splitKeyID(ciphertext)
+		plaintext, err = e.open(keyID, payload, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonData interface{}
+	if err := service.DecodeJSON(bytes.NewReader(plaintext), &jsonData); err != nil {
+		return nil, invalidCiphertext("failed to decrypt data")
+	}
+	return jsonData, nil
+}
+
+func (e *aeadEncryptor) Recognizes(ciphertext string) bool {
+	return recognizesEnvelope(e.algorithm, ciphertext)
+}
+
+func (e *aeadEncryptor) seal(plaintext []byte, additionalData []byte) (string, error) {
+	aead := e.aeads[e.activeID]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := aead.Seal(nonce, nonce, plaintext, additionalData)
+	envelope := Envelope{
+		Version:   EnvelopeV1,
+		Algorithm: e.algorithm,
+		KeyID:     e.activeID,
+		Payload:   base64.StdEncoding.EncodeToString(ciphertext),
+	}
+	return envelope.String(), nil
+}
+
+// open opens the payload of an envelope.
+func (e *aeadEncryptor) open(keyID string, payload string, additionalData []byte) ([]byte, error) {
+	aead, ok := e.aeads[keyID]
+	if !ok {
+		return nil, &service.UnknownKeyError{KeyID: keyID}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, invalidCiphertext("invalid ciphertext")
+	}
+
+	if len(decoded) < aead.NonceSize() {
+		return nil, invalidCiphertext("invalid ciphertext")
+	}
+
+	nonce := decoded[:aead.NonceSize()]
+	encryptedText := decoded[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, encryptedText, additionalData)
+	if err != nil {
+		return nil, authenticationFailed()
+	}
+
+	return plaintext, nil
+}
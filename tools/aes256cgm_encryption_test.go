@@ -1,8 +1,14 @@
 package tools
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"reflect"
+	"riot-api/service"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -117,8 +123,7 @@ func TestAESEncryptor_Decrypt_ShortCiphertext(t *testing.T) {
 	}
 
 	// Providing a short ciphertext
-	shortCiphertext := "short"
-	_, err = encryptor.decryptAES(shortCiphertext)
+	_, err = encryptor.Decrypt(map[string]interface{}{"key1": "c2hvcnQ="})
 	if err == nil {
 		t.Fatal("expected error for short ciphertext, but got none")
 	}
@@ -212,3 +217,164 @@ func TestDecrypt_ErrorCreatingAESCipher(t *testing.T) {
 	})
 
 }
+
+func TestAESEncryptor_KeyRotation(t *testing.T) {
+	// Prepare: encrypt with v1, then rotate to v2 and keep v1 as retired
+	oldKeyring, _ := NewKeyring("v1", []byte(AES_256_GCM_ENCRYPTION_KEY))
+	oldEncryptor, err := NewAESKeyringEncryptor(oldKeyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	oldData, err := oldEncryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+	if err != nil {
+		t.Fatalf("expected no error during encryption, but got %v", err)
+	}
+
+	keyring := newTestKeyring(t, "v2", map[string]string{"v1": AES_256_GCM_ENCRYPTION_KEY, "v2": "0123456789abcdef0123456789abcdef"})
+	encryptor, err := NewAESKeyringEncryptor(keyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Perform
+	newData, err := encryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+	if err != nil {
+		t.Fatalf("expected no error during encryption, but got %v", err)
+	}
+	decryptedOld, errOld := encryptor.Decrypt(oldData)
+	decryptedNew, errNew := encryptor.Decrypt(newData)
+
+	// Check: the key ID is embedded and both generations decrypt
+	assert.True(t, strings.HasPrefix(oldData["key1"].(string), "riot:v1:aes-256-gcm:v1:"))
+	assert.True(t, strings.HasPrefix(newData["key1"].(string), "riot:v1:aes-256-gcm:v2:"))
+	assert.NoError(t, errOld)
+	assert.NoError(t, errNew)
+	assert.Equal(t, "value1", decryptedOld["key1"])
+	assert.Equal(t, "value1", decryptedNew["key1"])
+}
+
+func TestAESEncryptor_Decrypt_UnknownKey(t *testing.T) {
+	// Prepare
+	keyring, _ := NewKeyring("v2", []byte(AES_256_GCM_ENCRYPTION_KEY))
+	encryptor, err := NewAESKeyringEncryptor(keyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	data := map[string]interface{}{"key1": "v1:InZhbHVlMSI="}
+
+	// Perform
+	_, err = encryptor.Decrypt(data)
+
+	// Check
+	assert.ErrorIs(t, err, service.ErrUnknownKey)
+}
+
+// sealUnboundAES seals plaintext with AES-GCM and no associated data, as ciphertexts were before
+// values were bound to their field, and returns the base64 nonce and sealed value.
+func sealUnboundAES(t *testing.T, key []byte, plaintext string) string {
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+func TestAESEncryptor_Decrypt_LegacyCiphertext(t *testing.T) {
+	// Prepare: ciphertext produced before envelopes existed
+	key := []byte(AES_256_GCM_ENCRYPTION_KEY)
+	encryptor, err := NewAESEncryptor(key)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	ciphertext := sealUnboundAES(t, key, `"value1"`)
+
+	// Perform
+	decryptedData, err := encryptor.Decrypt(map[string]interface{}{"key1": ciphertext})
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", decryptedData["key1"])
+}
+
+func TestAESEncryptor_Decrypt_ForeignAlgorithm(t *testing.T) {
+	// Prepare
+	key := []byte(AES_256_GCM_ENCRYPTION_KEY)
+	encryptor, err := NewAESEncryptor(key)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	data := map[string]interface{}{"key1": "riot:v1:base64::InZhbHVlMSI="}
+
+	// Perform
+	_, err = encryptor.Decrypt(data)
+
+	// Check
+	assert.EqualError(t, err, "unsupported algorithm base64")
+}
+
+func TestAESEncryptor_Recognizes(t *testing.T) {
+	// Prepare
+	key := []byte(AES_256_GCM_ENCRYPTION_KEY)
+	encryptor, err := NewAESEncryptor(key)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	ciphertext, _ := encryptor.EncryptValue(service.KeyBinding("key1", ""), "value1")
+
+	// Perform & Check
+	assert.True(t, encryptor.Recognizes(ciphertext))
+	assert.False(t, encryptor.Recognizes("riot:v1:base64::InZhbHVlMSI="))
+	assert.False(t, encryptor.Recognizes("value1"))
+}
+
+func TestAESEncryptor_Decrypt_SwappedFields(t *testing.T) {
+	// Prepare
+	key := []byte(AES_256_GCM_ENCRYPTION_KEY)
+	encryptor, err := NewAESEncryptor(key)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	encryptedData, err := encryptor.Encrypt(map[string]interface{}{
+		"role": "admin",
+		"name": "mallory",
+	})
+	if err != nil {
+		t.Fatalf("expected no error during encryption, but got %v", err)
+	}
+
+	// Perform: move the ciphertext of "role" into "name"
+	encryptedData["name"] = encryptedData["role"]
+	_, err = encryptor.Decrypt(encryptedData)
+
+	// Check
+	if err == nil {
+		t.Fatal("expected error for a ciphertext moved to another field, but got none")
+	}
+}
+
+func TestAESEncryptor_DecryptValue_Context(t *testing.T) {
+	// Prepare
+	key := []byte(AES_256_GCM_ENCRYPTION_KEY)
+	encryptor, err := NewAESEncryptor(key)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	binding := service.KeyBinding("ssn", "tenant-1")
+	ciphertext, err := encryptor.EncryptValue(binding, "123-45-6789")
+	if err != nil {
+		t.Fatalf("expected no error during encryption, but got %v", err)
+	}
+
+	// Perform
+	plaintext, err := encryptor.DecryptValue(binding, ciphertext)
+	_, errOtherRecord := encryptor.DecryptValue(service.KeyBinding("ssn", "tenant-2"), ciphertext)
+	_, errNoContext := encryptor.DecryptValue(service.KeyBinding("ssn", ""), ciphertext)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "123-45-6789", plaintext)
+	assert.Error(t, errOtherRecord)
+	assert.Error(t, errNoContext)
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"riot-api/service"
+)
+
+const AESSIVAlgorithm = "aes-siv"
+
+// sivKeyInfo separates the AES-SIV keys derived from an encryption key from any other use of it
+const sivKeyInfo = "riot-api aes-siv"
+
+// SIVEncryptor encrypts deterministically with AES-256-SIV (RFC 5297), so the same value, key
+// and binding always give the same ciphertext. It can be used to look up or join on encrypted
+// values, at the cost of revealing which values are equal.
+type SIVEncryptor struct {
+	activeID string
+	sivs     map[string]*siv
+}
+
+func NewAESSIVEncryptor(key []byte) (*SIVEncryptor, error) {
+	keyring, err := NewKeyring("", key)
+	if err != nil {
+		return nil, err
+	}
+	return NewAESSIVKeyringEncryptor(keyring)
+}
+
+// NewAESSIVKeyringEncryptor derives a 512-bit AES-SIV key from each 256-bit key of the keyring
+// with HKDF-SHA256.
+func NewAESSIVKeyringEncryptor(keyring *Keyring) (*SIVEncryptor, error) {
+	for _, id := range keyring.IDs() {
+		if key, _ := keyring.Key(id); len(key) != AES256KeySize {
+			return nil, fmt.Errorf("key must be %d bytes", AES256KeySize)
+		}
+	}
+
+	sivKeyring, err := keyring.Derive(sivKeyInfo, 2*AES256KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	sivs := make(map[string]*siv)
+	for _, id := range sivKeyring.IDs() {
+		sivKey, _ := sivKeyring.Key(id)
+		s, err := newSIV(sivKey)
+		if err != nil {
+			return nil, err
+		}
+		sivs[id] = s
+	}
+
+	return &SIVEncryptor{activeID: keyring.ActiveID(), sivs: sivs}, nil
+}
+
+func (e *SIVEncryptor) Encrypt(data map[string]interface{}) (map[string]interface{}, error) {
+	return service.EncryptValues(e, data, "")
+}
+
+func (e *SIVEncryptor) Decrypt(data map[string]interface{}) (map[string]interface{}, error) {
+	return service.DecryptValues(e, data, "")
+}
+
+func (e *SIVEncryptor) Algorithm() string {
+	return AESSIVAlgorithm
+}
+
+// EncryptValue encrypts the value into an envelope, authenticated along with its binding. Array
+// indexes are left out of the binding, so equal values in an array have equal ciphertexts.
+func (e *SIVEncryptor) EncryptValue(binding service.Binding, value interface{}) (string, error) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.New("failed to encrypt data")
+	}
+
+	envelope := Envelope{
+		Version:   EnvelopeV1,
+		Algorithm: AESSIVAlgorithm,
+		KeyID:     e.activeID,
+		Payload:   base64.StdEncoding.EncodeToString(e.sivs[e.activeID].seal(jsonData, associatedData(withoutIndexes(binding)))),
+	}
+	return envelope.String(), nil
+}
+
+func (e *SIVEncryptor) EncryptValueDeterministically(binding service.Binding, value interface{}) (string, error) {
+	return e.EncryptValue(binding, value)
+}
+
+func (e *SIVEncryptor) DecryptValue(binding service.Binding, ciphertext string) (interface{}, error) {
+	if !IsEnvelope(ciphertext) {
+		return nil, invalidCiphertext("invalid ciphertext")
+	}
+	envelope, err := openEnvelope(AESSIVAlgorithm, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := e.sivs[envelope.KeyID]
+	if !ok {
+		return nil, &service.UnknownKeyError{KeyID: envelope.KeyID}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, invalidCiphertext("invalid ciphertext")
+	}
+
+	plaintext, err := s.open(decoded, associatedData(withoutIndexes(binding)))
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonData interface{}
+	if err := service.DecodeJSON(bytes.NewReader(plaintext), &jsonData); err != nil {
+		return nil, invalidCiphertext("failed to decrypt data")
+	}
+	return jsonData, nil
+}
+
+func (e *SIVEncryptor) Recognizes(ciphertext string) bool {
+	return recognizesEnvelope(AESSIVAlgorithm, ciphertext)
+}
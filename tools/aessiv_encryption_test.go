@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"encoding/json"
+	"riot-api/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSIVEncryptor_InvalidKey(t *testing.T) {
+	// Perform
+	_, err := NewAESSIVEncryptor([]byte("shortkey"))
+
+	// Check
+	assert.Error(t, err)
+}
+
+func TestSIVEncryptor_EncryptDecrypt(t *testing.T) {
+	// Prepare
+	encryptor, err := NewAESSIVEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	data := map[string]interface{}{
+		"key1": "value1",
+		"key2": 123,
+		"key4": []interface{}{333, "value4"},
+	}
+
+	// Perform
+	encryptedData, err := encryptor.Encrypt(data)
+	if err != nil {
+		t.Fatalf("expected no error during encryption, but got %v", err)
+	}
+	decryptedData, err := encryptor.Decrypt(encryptedData)
+
+	// Check
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encryptedData["key1"].(string), "riot:v1:aes-siv::"))
+	assert.Equal(t, "value1", decryptedData["key1"])
+	assert.Equal(t, json.Number("123"), decryptedData["key2"])
+	assert.Equal(t, []interface{}{json.Number("333"), "value4"}, decryptedData["key4"])
+}
+
+func TestSIVEncryptor_Deterministic(t *testing.T) {
+	// Prepare
+	encryptor, _ := NewAESSIVEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	binding := service.KeyBinding("email", "tenant-1")
+
+	// Perform
+	first, _ := encryptor.EncryptValueDeterministically(binding, "ann@example.com")
+	second, _ := encryptor.EncryptValueDeterministically(binding, "ann@example.com")
+	otherValue, _ := encryptor.EncryptValue(binding, "bob@example.com")
+	otherField, _ := encryptor.EncryptValue(service.KeyBinding("login", "tenant-1"), "ann@example.com")
+	otherContext, _ := encryptor.EncryptValue(service.KeyBinding("email", "tenant-2"), "ann@example.com")
+
+	// Check: equal only for the same value, key, field and context
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, otherValue)
+	assert.NotEqual(t, first, otherField)
+	assert.NotEqual(t, first, otherContext)
+}
+
+func TestSIVEncryptor_Deterministic_ArrayIndexes(t *testing.T) {
+	// Prepare
+	encryptor, _ := NewAESSIVEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	binding := func(path ...interface{}) service.Binding { return service.Binding{Path: path, Context: "tenant-1"} }
+
+	// Perform
+	first, _ := encryptor.EncryptValue(binding("users", 0, "email"), "ann@example.com")
+	second, _ := encryptor.EncryptValue(binding("users", 1, "email"), "ann@example.com")
+	plaintext, err := encryptor.DecryptValue(binding("users", 7, "email"), first)
+	otherKey, _ := encryptor.EncryptValue(binding("users", "0", "email"), "ann@example.com")
+
+	// Check: equal at any position of the array, but not under an object key
+	assert.Equal(t, first, second)
+	assert.NoError(t, err)
+	assert.Equal(t, "ann@example.com", plaintext)
+	assert.NotEqual(t, first, otherKey)
+}
+
+func TestSIVEncryptor_DecryptValue_WrongBinding(t *testing.T) {
+	// Prepare
+	encryptor, _ := NewAESSIVEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	ciphertext, _ := encryptor.EncryptValue(service.KeyBinding("role", ""), "admin")
+
+	// Perform
+	_, err := encryptor.DecryptValue(service.KeyBinding("name", ""), ciphertext)
+
+	// Check
+	assert.Error(t, err)
+}
+
+func TestSIVEncryptor_Decrypt_Invalid(t *testing.T) {
+	// Prepare
+	encryptor, _ := NewAESSIVEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+
+	for _, ciphertext := range []string{"InZhbHVlMSI=", "riot:v1:aes-siv::c2hvcnQ=", "riot:v1:aes-siv:v9:InZhbHVlMSI=", "riot:v2:aes-siv::InZhbHVlMSI=", "riot:v1:base64::InZhbHVlMSI="} {
+		// Perform
+		_, err := encryptor.DecryptValue(service.KeyBinding("key1", ""), ciphertext)
+
+		// Check
+		assert.Error(t, err, ciphertext)
+	}
+}
+
+func TestSIVEncryptor_KeyRotation(t *testing.T) {
+	// Prepare
+	oldKeyring, _ := NewKeyring("v1", []byte(AES_256_GCM_ENCRYPTION_KEY))
+	oldEncryptor, _ := NewAESSIVKeyringEncryptor(oldKeyring)
+	oldCiphertext, _ := oldEncryptor.EncryptValue(service.KeyBinding("key1", ""), "value1")
+
+	keyring := newTestKeyring(t, "v2", map[string]string{"v1": AES_256_GCM_ENCRYPTION_KEY, "v2": CHACHA20_ENCRYPTION_KEY})
+	encryptor, err := NewAESSIVKeyringEncryptor(keyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Perform
+	plaintext, err := encryptor.DecryptValue(service.KeyBinding("key1", ""), oldCiphertext)
+	newCiphertext, _ := encryptor.EncryptValue(service.KeyBinding("key1", ""), "value1")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", plaintext)
+	assert.True(t, strings.HasPrefix(newCiphertext, "riot:v1:aes-siv:v2:"))
+}
@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"riot-api/service"
+	"sync/atomic"
+)
+
+// FileAPIKeyStore authenticates API keys against a JSON file of their SHA-256 hashes, read when
+// the store is created and again on Reload:
+//
+//	{
+//	  "keys": [
+//	    {"name": "frontend", "sha256": "<hex SHA-256 of the key>", "scopes": ["verify"]},
+//	    {"name": "billing", "sha256": "<hex SHA-256 of the key>", "scopes": ["encrypt", "decrypt"]}
+//	  ]
+//	}
+type FileAPIKeyStore struct {
+	path string
+	keys atomic.Pointer[[]apiKeyFileEntry]
+}
+
+type apiKeyFileEntry struct {
+	Name   string   `json:"name"`
+	SHA256 string   `json:"sha256"`
+	Scopes []string `json:"scopes"`
+	hash   []byte
+}
+
+func NewFileAPIKeyStore(path string) (*FileAPIKeyStore, error) {
+	store := &FileAPIKeyStore{path: path}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload reads the file again, keeping the current keys when it is invalid.
+func (s *FileAPIKeyStore) Reload() error {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Keys []apiKeyFileEntry `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("invalid API keys file: %w", err)
+	}
+
+	names := make(map[string]bool)
+	hashes := make(map[string]bool)
+	for i := range file.Keys {
+		entry := &file.Keys[i]
+		if entry.Name == "" || names[entry.Name] {
+			return fmt.Errorf("API key %d must have a unique name", i)
+		}
+		names[entry.Name] = true
+
+		entry.hash, err = hex.DecodeString(entry.SHA256)
+		if err != nil || len(entry.hash) != sha256.Size {
+			return fmt.Errorf("API key %q must have a hex encoded SHA-256 hash", entry.Name)
+		}
+		if hashes[string(entry.hash)] {
+			return fmt.Errorf("API key %q has the same hash as another key", entry.Name)
+		}
+		hashes[string(entry.hash)] = true
+
+		for _, scope := range entry.Scopes {
+			if !validScope(scope) {
+				return fmt.Errorf("API key %q has unknown scope %q", entry.Name, scope)
+			}
+		}
+	}
+
+	s.keys.Store(&file.Keys)
+	return nil
+}
+
+// Authenticate compares the hash of the key with every stored hash in constant time.
+func (s *FileAPIKeyStore) Authenticate(key string) (service.Principal, error) {
+	if key == "" {
+		return service.Principal{}, service.ErrInvalidAPIKey
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	var match *apiKeyFileEntry
+	keys := *s.keys.Load()
+	for i := range keys {
+		if subtle.ConstantTimeCompare(hash[:], keys[i].hash) == 1 {
+			match = &keys[i]
+		}
+	}
+	if match == nil {
+		return service.Principal{}, service.ErrInvalidAPIKey
+	}
+	return service.Principal{Name: match.Name, Scopes: match.Scopes}, nil
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of an API key, as stored in the API keys file.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func validScope(scope string) bool {
+	for _, known := range service.Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
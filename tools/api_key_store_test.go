@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"riot-api/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func apiKeysFile(entries ...string) string {
+	content := `{"keys": [`
+	for i, entry := range entries {
+		if i > 0 {
+			content += ","
+		}
+		content += entry
+	}
+	return content + `]}`
+}
+
+func apiKeyEntry(name, key string, scopes string) string {
+	return fmt.Sprintf(`{"name": %q, "sha256": %q, "scopes": %s}`, name, HashAPIKey(key), scopes)
+}
+
+func TestFileAPIKeyStore(t *testing.T) {
+	// Prepare
+	path := writeKeyringFile(t, apiKeysFile(
+		apiKeyEntry("frontend", "frontend-key", `["verify"]`),
+		apiKeyEntry("billing", "billing-key", `["encrypt", "decrypt"]`),
+	))
+	store, err := NewFileAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Perform
+	frontend, errFrontend := store.Authenticate("frontend-key")
+	billing, errBilling := store.Authenticate("billing-key")
+	_, errUnknown := store.Authenticate("unknown-key")
+	_, errEmpty := store.Authenticate("")
+
+	// Check
+	assert.NoError(t, errFrontend)
+	assert.Equal(t, "frontend", frontend.Name)
+	assert.True(t, frontend.HasScope(service.ScopeVerify))
+	assert.False(t, frontend.HasScope(service.ScopeSign))
+	assert.NoError(t, errBilling)
+	assert.Equal(t, []string{"encrypt", "decrypt"}, billing.Scopes)
+	assert.ErrorIs(t, errUnknown, service.ErrInvalidAPIKey)
+	assert.ErrorIs(t, errEmpty, service.ErrInvalidAPIKey)
+}
+
+func TestFileAPIKeyStore_Reload(t *testing.T) {
+	// Prepare
+	path := writeKeyringFile(t, apiKeysFile(apiKeyEntry("old", "old-key", `["sign"]`)))
+	store, _ := NewFileAPIKeyStore(path)
+
+	// Perform
+	os.WriteFile(path, []byte(apiKeysFile(apiKeyEntry("new", "new-key", `["sign"]`))), 0600)
+	errReload := store.Reload()
+	_, errOld := store.Authenticate("old-key")
+	principal, errNew := store.Authenticate("new-key")
+
+	os.WriteFile(path, []byte(`not json`), 0600)
+	errInvalid := store.Reload()
+	_, errKept := store.Authenticate("new-key")
+
+	// Check
+	assert.NoError(t, errReload)
+	assert.ErrorIs(t, errOld, service.ErrInvalidAPIKey)
+	assert.NoError(t, errNew)
+	assert.Equal(t, "new", principal.Name)
+	assert.Error(t, errInvalid)
+	assert.NoError(t, errKept)
+}
+
+func TestNewFileAPIKeyStore_Invalid(t *testing.T) {
+	for _, content := range []string{
+		`not json`,
+		apiKeysFile(`{"name": "frontend", "sha256": "not hex", "scopes": ["verify"]}`),
+		apiKeysFile(`{"name": "frontend", "sha256": "abcd", "scopes": ["verify"]}`),
+		apiKeysFile(apiKeyEntry("", "frontend-key", `["verify"]`)),
+		apiKeysFile(apiKeyEntry("frontend", "frontend-key", `["admin"]`)),
+		apiKeysFile(apiKeyEntry("frontend", "frontend-key", `["verify"]`), apiKeyEntry("frontend", "other-key", `["verify"]`)),
+		apiKeysFile(apiKeyEntry("frontend", "frontend-key", `["verify"]`), apiKeyEntry("backend", "frontend-key", `["sign"]`)),
+	} {
+		// Perform
+		_, err := NewFileAPIKeyStore(writeKeyringFile(t, content))
+
+		// Check
+		assert.Error(t, err, content)
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	// Perform
+	hash := HashAPIKey("abc")
+
+	// Check
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", hash)
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"riot-api/service"
+	"sort"
+	"strings"
+)
+
+// ParsePrivateKey reads a PKCS#8, SEC 1 (EC) or PKCS#1 (RSA) private key, either PEM encoded or
+// as hex/base64 encoded DER. A 32 bytes hex or base64 value is accepted as an Ed25519 seed, and a
+// 64 bytes one as an Ed25519 private key, the form Vault Transit exports them in.
+func ParsePrivateKey(encoded string) (crypto.Signer, error) {
+	encoded = strings.TrimSpace(encoded)
+
+	var der []byte
+	if block, _ := pem.Decode([]byte(encoded)); block != nil {
+		der = block.Bytes
+	} else if seed, err := DecodeKey(encoded, ed25519.SeedSize); err == nil {
+		return ed25519.NewKeyFromSeed(seed), nil
+	} else if key, err := DecodeKey(encoded, ed25519.PrivateKeySize); err == nil {
+		privateKey := ed25519.NewKeyFromSeed(key[:ed25519.SeedSize])
+		if !privateKey.Equal(ed25519.PrivateKey(key)) {
+			return nil, errors.New("ed25519 public key does not match its seed")
+		}
+		return privateKey, nil
+	} else if decoded, err := hex.DecodeString(encoded); err == nil {
+		der = decoded
+	} else if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		der = decoded
+	} else {
+		return nil, errors.New("private key must be PEM, hex or base64 encoded")
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("private key must be a PKCS#8, SEC 1 or PKCS#1 key")
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+func encodePublicKeyPEM(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// signingKeys holds the private keys of an asymmetric signer by ID, as a Keyring does for HMAC
+// keys: the active key signs, and the key whose ID prefixes a signature verifies it.
+type signingKeys[K crypto.Signer] struct {
+	activeID string
+	keys     map[string]K
+}
+
+func newSigningKey[K crypto.Signer](key K) signingKeys[K] {
+	return signingKeys[K]{keys: map[string]K{"": key}}
+}
+
+// parseSigningKeys parses the private key of every key of the keyring, checking each with check.
+func parseSigningKeys[K crypto.Signer](keyring *Keyring, check func(key crypto.Signer) (K, error)) (signingKeys[K], error) {
+	keys := signingKeys[K]{activeID: keyring.ActiveID(), keys: make(map[string]K)}
+	for _, id := range keyring.IDs() {
+		material, _ := keyring.Key(id)
+		privateKey, err := ParsePrivateKey(string(material))
+		if err != nil {
+			return keys, fmt.Errorf("signing key %q: %w", id, err)
+		}
+		key, err := check(privateKey)
+		if err != nil {
+			return keys, fmt.Errorf("signing key %q: %w", id, err)
+		}
+		keys.keys[id] = key
+	}
+	return keys, nil
+}
+
+func (k signingKeys[K]) active() (string, K) {
+	return k.activeID, k.keys[k.activeID]
+}
+
+// forSignature returns the ID and key of the key that produced a signature, and the signature
+// without its key ID.
+func (k signingKeys[K]) forSignature(signature string) (string, K, string, bool) {
+	keyID, payload := splitKeyID(signature)
+	key, ok := k.keys[keyID]
+	return keyID, key, payload, ok
+}
+
+// publicKeys returns the public key of the active key, then those of the retired keys by ID.
+func (k signingKeys[K]) publicKeys() ([]service.PublicKey, error) {
+	ids := []string{k.activeID}
+	for id := range k.keys {
+		if id != k.activeID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids[1:])
+
+	publicKeys := make([]service.PublicKey, 0, len(ids))
+	for _, id := range ids {
+		encoded, err := encodePublicKeyPEM(k.keys[id].Public())
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, service.PublicKey{KeyID: id, PEM: encoded})
+	}
+	return publicKeys, nil
+}
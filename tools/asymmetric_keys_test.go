@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// privateKey is implemented by the private keys of every asymmetric algorithm
+type privateKey interface {
+	Equal(x crypto.PrivateKey) bool
+}
+
+func TestParsePrivateKey_PEM(t *testing.T) {
+	// Prepare
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	// Perform
+	parsed, err := ParsePrivateKey(string(encoded))
+
+	// Check
+	assert.NoError(t, err)
+	assert.True(t, privateKey.Equal(parsed))
+}
+
+func TestParsePrivateKey_Base64DER(t *testing.T) {
+	// Prepare
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+
+	// Perform
+	parsed, err := ParsePrivateKey(base64.StdEncoding.EncodeToString(der))
+
+	// Check
+	assert.NoError(t, err)
+	assert.True(t, privateKey.Equal(parsed))
+}
+
+func TestParsePrivateKey_Ed25519Seed(t *testing.T) {
+	// Perform
+	parsed, err := ParsePrivateKey(SIGNING_KEY_TEST_1)
+
+	// Check
+	assert.NoError(t, err)
+	assert.IsType(t, ed25519.PrivateKey{}, parsed)
+}
+
+func TestParsePrivateKey_VaultExports(t *testing.T) {
+	// Prepare: Vault Transit exports EC keys as SEC 1, RSA keys as PKCS#1 and Ed25519 keys raw
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sec1, _ := x509.MarshalECPrivateKey(ecdsaKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, RSAMinimumKeyBits)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := map[string]struct {
+		encoded  string
+		expected privateKey
+	}{
+		"ecdsa":   {string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})), ecdsaKey},
+		"rsa":     {string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})), rsaKey},
+		"ed25519": {base64.StdEncoding.EncodeToString(ed25519Key), ed25519Key},
+	}
+
+	for name, test := range tests {
+		// Perform
+		parsed, err := ParsePrivateKey(test.encoded)
+
+		// Check
+		assert.NoError(t, err, name)
+		assert.True(t, test.expected.Equal(parsed), name)
+	}
+}
+
+func TestParsePrivateKey_Invalid(t *testing.T) {
+	// An Ed25519 key whose public half does not match its seed
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	ed25519Key[len(ed25519Key)-1] ^= 1
+
+	for _, encoded := range []string{"not a key!", "c2hvcnQ=", base64.StdEncoding.EncodeToString(ed25519Key)} {
+		// Perform
+		_, err := ParsePrivateKey(encoded)
+
+		// Check
+		assert.Error(t, err)
+	}
+}
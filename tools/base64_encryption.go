@@ -1,11 +1,15 @@
 package tools
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"riot-api/service"
 )
 
+const Base64Algorithm = "base64"
+
 type Base64Encryptor struct{}
 
 func NewBase64Encryptor() *Base64Encryptor {
@@ -13,41 +17,46 @@ func NewBase64Encryptor() *Base64Encryptor {
 }
 
 func (e *Base64Encryptor) Encrypt(data map[string]interface{}) (map[string]interface{}, error) {
-	encryptedData := make(map[string]interface{})
+	return service.EncryptValues(e, data, "")
+}
 
-	for key, value := range data {
-		jsonData, err := json.Marshal(value)
-		if err != nil {
-			return nil, fmt.Errorf("failed to encrypt data")
-		}
+func (e *Base64Encryptor) Decrypt(data map[string]interface{}) (map[string]interface{}, error) {
+	return service.DecryptValues(e, data, "")
+}
 
-		encryptedData[key] = base64.StdEncoding.EncodeToString(jsonData)
+func (e *Base64Encryptor) Algorithm() string {
+	return Base64Algorithm
+}
+
+// EncryptValue encodes the value, Base64 has no way to bind it.
+func (e *Base64Encryptor) EncryptValue(binding service.Binding, value interface{}) (string, error) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt data")
 	}
-	return encryptedData, nil
+
+	envelope := Envelope{Algorithm: Base64Algorithm, Payload: base64.StdEncoding.EncodeToString(jsonData)}
+	return envelope.String(), nil
 }
 
-func (e *Base64Encryptor) Decrypt(data map[string]interface{}) (map[string]interface{}, error) {
-	decryptedData := make(map[string]interface{})
-
-	for key, value := range data {
-		if str, ok := value.(string); ok {
-			decoded, err := base64.StdEncoding.DecodeString(str)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decrypt data")
-			}
-
-			var jsonData interface{}
-			err = json.Unmarshal(decoded, &jsonData)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decrypt data")
-			} else {
-
-				decryptedData[key] = jsonData
-			}
-
-		} else {
-			return nil, fmt.Errorf("values must be string")
-		}
+func (e *Base64Encryptor) DecryptValue(binding service.Binding, ciphertext string) (interface{}, error) {
+	envelope, err := openEnvelope(Base64Algorithm, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, invalidCiphertext("failed to decrypt data")
 	}
-	return decryptedData, nil
+
+	var jsonData interface{}
+	if err := service.DecodeJSON(bytes.NewReader(decoded), &jsonData); err != nil {
+		return nil, invalidCiphertext("failed to decrypt data")
+	}
+	return jsonData, nil
+}
+
+func (e *Base64Encryptor) Recognizes(ciphertext string) bool {
+	return recognizesEnvelope(Base64Algorithm, ciphertext)
 }
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
@@ -21,9 +22,10 @@ func normalizeValue(v interface{}) interface{} {
 			normalizedMap[k] = normalizeValue(val)
 		}
 		return normalizedMap
-	case int:
-		// Convert int to float64 to match JSON decoding behavior
-		return float64(v)
+	case int, float64:
+		// Numbers are decoded as json.Number, written as they were encoded
+		encoded, _ := json.Marshal(v)
+		return json.Number(encoded)
 	default:
 		return v
 	}
@@ -171,3 +173,36 @@ func TestBase64Encryptor_Decryption_EmptyData(t *testing.T) {
 		t.Fatalf("expected decrypted data to be empty, but got %v", decryptedData)
 	}
 }
+
+func TestBase64Encryptor_Encrypt_Envelope(t *testing.T) {
+	// Prepare
+	encryptor := NewBase64Encryptor()
+
+	// Perform
+	encryptedData, err := encryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+
+	// Check
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if encryptedData["key1"] != "riot:v1:base64::InZhbHVlMSI=" {
+		t.Fatalf("expected an envelope, but got %v", encryptedData["key1"])
+	}
+}
+
+func TestBase64Encryptor_Decrypt_LegacyValue(t *testing.T) {
+	// Prepare: value produced before envelopes existed
+	encryptor := NewBase64Encryptor()
+	data := map[string]interface{}{"key1": "InZhbHVlMSI="}
+
+	// Perform
+	decryptedData, err := encryptor.Decrypt(data)
+
+	// Check
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if decryptedData["key1"] != "value1" {
+		t.Fatalf("expected value1, but got %v", decryptedData["key1"])
+	}
+}
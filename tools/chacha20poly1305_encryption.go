@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	ChaCha20Poly1305Algorithm  = "chacha20-poly1305"
+	XChaCha20Poly1305Algorithm = "xchacha20-poly1305"
+	ChaCha20KeySize            = chacha20poly1305.KeySize
+)
+
+// chachaKeyInfo prefixes the algorithm in the HKDF info deriving its key
+const chachaKeyInfo = "riot-api "
+
+// ChaChaEncryptor encrypts with ChaCha20-Poly1305 (12-byte nonces), or XChaCha20-Poly1305 whose
+// 24-byte nonces are safe to pick at random for any number of values under the same key.
+//
+// Each algorithm uses its own key, derived from the configured one, so a key shared with AES-GCM
+// is never used as is by two ciphers.
+type ChaChaEncryptor struct {
+	*aeadEncryptor
+}
+
+func NewChaCha20Encryptor(key []byte) (*ChaChaEncryptor, error) {
+	keyring, err := NewKeyring("", key)
+	if err != nil {
+		return nil, err
+	}
+	return NewChaCha20KeyringEncryptor(keyring)
+}
+
+func NewChaCha20KeyringEncryptor(keyring *Keyring) (*ChaChaEncryptor, error) {
+	return newChaChaEncryptor(ChaCha20Poly1305Algorithm, keyring, chacha20poly1305.New)
+}
+
+func NewXChaCha20Encryptor(key []byte) (*ChaChaEncryptor, error) {
+	keyring, err := NewKeyring("", key)
+	if err != nil {
+		return nil, err
+	}
+	return NewXChaCha20KeyringEncryptor(keyring)
+}
+
+func NewXChaCha20KeyringEncryptor(keyring *Keyring) (*ChaChaEncryptor, error) {
+	return newChaChaEncryptor(XChaCha20Poly1305Algorithm, keyring, func(key []byte) (cipher.AEAD, error) {
+		return chacha20poly1305.NewX(key)
+	})
+}
+
+func newChaChaEncryptor(algorithm string, keyring *Keyring, newAEAD func(key []byte) (cipher.AEAD, error)) (*ChaChaEncryptor, error) {
+	for _, id := range keyring.IDs() {
+		if key, _ := keyring.Key(id); len(key) != ChaCha20KeySize {
+			return nil, fmt.Errorf("key must be %d bytes", ChaCha20KeySize)
+		}
+	}
+
+	derived, err := keyring.Derive(chachaKeyInfo+algorithm, ChaCha20KeySize)
+	if err != nil {
+		return nil, err
+	}
+	encryptor, err := newAEADEncryptor(algorithm, derived, newAEAD)
+	if err != nil {
+		return nil, err
+	}
+	return &ChaChaEncryptor{encryptor}, nil
+}
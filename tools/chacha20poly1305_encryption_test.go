@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"reflect"
+	"riot-api/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const CHACHA20_ENCRYPTION_KEY = "Vh3rQ8yNcB1kT5oWz0LpXe7aJ2uGm9sD"
+
+var chachaConstructors = map[string]func(key []byte) (*ChaChaEncryptor, error){
+	ChaCha20Poly1305Algorithm:  NewChaCha20Encryptor,
+	XChaCha20Poly1305Algorithm: NewXChaCha20Encryptor,
+}
+
+func TestChaChaEncryptor_InvalidKey(t *testing.T) {
+	for algorithm, newEncryptor := range chachaConstructors {
+		// Perform
+		_, err := newEncryptor([]byte("shortkey"))
+
+		// Check
+		assert.Error(t, err, algorithm)
+	}
+}
+
+func TestChaChaEncryptor_EncryptDecrypt(t *testing.T) {
+	for algorithm, newEncryptor := range chachaConstructors {
+		t.Run(algorithm, func(t *testing.T) {
+			// Prepare
+			encryptor, err := newEncryptor([]byte(CHACHA20_ENCRYPTION_KEY))
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+			data := map[string]interface{}{
+				"key1": "value1",
+				"key2": 123,
+				"key3": 123.123,
+				"key4": []interface{}{333, "value4"},
+			}
+
+			// Perform
+			encryptedData, err := encryptor.Encrypt(data)
+			if err != nil {
+				t.Fatalf("expected no error during encryption, but got %v", err)
+			}
+			decryptedData, err := encryptor.Decrypt(encryptedData)
+			if err != nil {
+				t.Fatalf("expected no error during decryption, but got %v", err)
+			}
+
+			// Check
+			for key, originalValue := range data {
+				assert.True(t, strings.HasPrefix(encryptedData[key].(string), "riot:v1:"+algorithm+"::"))
+				if !reflect.DeepEqual(normalizeValue(originalValue), normalizeValue(decryptedData[key])) {
+					t.Fatalf("expected decrypted value for %s to be %v, but got %v", key, originalValue, decryptedData[key])
+				}
+			}
+		})
+	}
+}
+
+func TestChaChaEncryptor_NonceSize(t *testing.T) {
+	expected := map[string]int{ChaCha20Poly1305Algorithm: 12, XChaCha20Poly1305Algorithm: 24}
+
+	for algorithm, newEncryptor := range chachaConstructors {
+		// Prepare
+		encryptor, _ := newEncryptor([]byte(CHACHA20_ENCRYPTION_KEY))
+
+		// Perform
+		ciphertext, err := encryptor.EncryptValue(service.KeyBinding("key1", ""), "")
+		envelope, _ := ParseEnvelope(ciphertext)
+		payload, _ := base64.StdEncoding.DecodeString(envelope.Payload)
+
+		// Check: nonce, the 2 byte plaintext `""`, then the 16 byte tag
+		assert.NoError(t, err)
+		assert.Len(t, payload, expected[algorithm]+2+16, algorithm)
+	}
+}
+
+func TestChaChaEncryptor_Decrypt_Tampered(t *testing.T) {
+	for algorithm, newEncryptor := range chachaConstructors {
+		// Prepare
+		encryptor, _ := newEncryptor([]byte(CHACHA20_ENCRYPTION_KEY))
+		ciphertext, _ := encryptor.EncryptValue(service.KeyBinding("key1", ""), "value1")
+		envelope, _ := ParseEnvelope(ciphertext)
+		payload, _ := base64.StdEncoding.DecodeString(envelope.Payload)
+		payload[len(payload)-1] ^= 1
+		envelope.Payload = base64.StdEncoding.EncodeToString(payload)
+
+		// Perform
+		_, err := encryptor.DecryptValue(service.KeyBinding("key1", ""), envelope.String())
+		_, errShort := encryptor.DecryptValue(service.KeyBinding("key1", ""), "riot:v1:"+algorithm+"::c2hvcnQ=")
+
+		// Check
+		assert.ErrorIs(t, err, service.ErrAuthenticationFailed, algorithm)
+		assert.EqualError(t, errShort, "invalid ciphertext", algorithm)
+		assert.ErrorIs(t, errShort, service.ErrInvalidCiphertext, algorithm)
+	}
+}
+
+func TestChaChaEncryptor_Decrypt_SwappedFieldsAndContext(t *testing.T) {
+	for algorithm, newEncryptor := range chachaConstructors {
+		// Prepare
+		encryptor, _ := newEncryptor([]byte(CHACHA20_ENCRYPTION_KEY))
+		binding := service.KeyBinding("role", "tenant-1")
+		ciphertext, _ := encryptor.EncryptValue(binding, "admin")
+
+		// Perform
+		plaintext, err := encryptor.DecryptValue(binding, ciphertext)
+		_, errOtherField := encryptor.DecryptValue(service.KeyBinding("name", "tenant-1"), ciphertext)
+		_, errOtherContext := encryptor.DecryptValue(service.KeyBinding("role", "tenant-2"), ciphertext)
+
+		// Check
+		assert.NoError(t, err, algorithm)
+		assert.Equal(t, "admin", plaintext, algorithm)
+		assert.Error(t, errOtherField, algorithm)
+		assert.Error(t, errOtherContext, algorithm)
+	}
+}
+
+func TestChaChaEncryptor_Decrypt_OtherAlgorithms(t *testing.T) {
+	// Prepare: the same key under a different algorithm
+	chacha, _ := NewChaCha20Encryptor([]byte(CHACHA20_ENCRYPTION_KEY))
+	xchacha, _ := NewXChaCha20Encryptor([]byte(CHACHA20_ENCRYPTION_KEY))
+	ciphertext, _ := chacha.EncryptValue(service.KeyBinding("key1", ""), "value1")
+
+	// Perform
+	_, err := xchacha.DecryptValue(service.KeyBinding("key1", ""), ciphertext)
+
+	// Check
+	assert.EqualError(t, err, "unsupported algorithm chacha20-poly1305")
+	assert.ErrorIs(t, err, service.ErrInvalidCiphertext)
+	assert.True(t, chacha.Recognizes(ciphertext))
+	assert.False(t, xchacha.Recognizes(ciphertext))
+}
+
+func TestChaChaEncryptor_KeyRotation(t *testing.T) {
+	// Prepare
+	oldKeyring, _ := NewKeyring("v1", []byte(CHACHA20_ENCRYPTION_KEY))
+	oldEncryptor, _ := NewXChaCha20KeyringEncryptor(oldKeyring)
+	oldData, _ := oldEncryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+
+	keyring := newTestKeyring(t, "v2", map[string]string{"v1": CHACHA20_ENCRYPTION_KEY, "v2": AES_256_GCM_ENCRYPTION_KEY})
+	encryptor, err := NewXChaCha20KeyringEncryptor(keyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Perform
+	newData, _ := encryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+	decryptedOld, errOld := encryptor.Decrypt(oldData)
+
+	// Check
+	assert.True(t, strings.HasPrefix(newData["key1"].(string), "riot:v1:xchacha20-poly1305:v2:"))
+	assert.NoError(t, errOld)
+	assert.Equal(t, "value1", decryptedOld["key1"])
+}
+
+func TestChaChaEncryptor_DerivesItsKey(t *testing.T) {
+	// Prepare: a key shared with AES-GCM
+	keyring, _ := NewKeyring("", []byte(CHACHA20_ENCRYPTION_KEY))
+	chacha, _ := NewChaCha20KeyringEncryptor(keyring)
+	xchacha, _ := NewXChaCha20KeyringEncryptor(keyring)
+	binding := service.KeyBinding("key1", "")
+
+	chachaCiphertext, _ := chacha.EncryptValue(binding, "value1")
+	xchachaCiphertext, _ := xchacha.EncryptValue(binding, "value1")
+
+	// Perform: open the payloads under the configured key itself
+	rawChaCha, _ := newAEADEncryptor(ChaCha20Poly1305Algorithm, keyring, chacha20poly1305.New)
+	rawXChaCha, _ := newAEADEncryptor(XChaCha20Poly1305Algorithm, keyring, func(key []byte) (cipher.AEAD, error) {
+		return chacha20poly1305.NewX(key)
+	})
+	_, errChaCha := rawChaCha.DecryptValue(binding, chachaCiphertext)
+	_, errXChaCha := rawXChaCha.DecryptValue(binding, xchachaCiphertext)
+
+	// Check
+	assert.ErrorIs(t, errChaCha, service.ErrAuthenticationFailed)
+	assert.ErrorIs(t, errXChaCha, service.ErrAuthenticationFailed)
+	chachaKeys, _ := keyring.Derive(chachaKeyInfo+ChaCha20Poly1305Algorithm, ChaCha20KeySize)
+	xchachaKeys, _ := keyring.Derive(chachaKeyInfo+XChaCha20Poly1305Algorithm, ChaCha20KeySize)
+	chachaKey, _ := chachaKeys.Key("")
+	xchachaKey, _ := xchachaKeys.Key("")
+	assert.NotEqual(t, chachaKey, xchachaKey)
+}
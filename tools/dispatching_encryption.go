@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"riot-api/service"
+)
+
+// DispatchingEncryptor encrypts with a primary encryptor and decrypts each envelope with the
+// encryptor matching its algorithm, so values keep decrypting after the configured algorithm
+// changes. Values that are not envelopes are decrypted with the primary encryptor.
+//
+// Deterministic encryption uses the first configured encryptor that supports it.
+type DispatchingEncryptor struct {
+	primary       service.ValueEncryptor
+	deterministic service.DeterministicEncryptor
+	encryptors    map[string]service.ValueEncryptor
+}
+
+func NewDispatchingEncryptor(primary service.ValueEncryptor, others ...service.ValueEncryptor) *DispatchingEncryptor {
+	e := &DispatchingEncryptor{primary: primary, encryptors: make(map[string]service.ValueEncryptor)}
+	for _, encryptor := range append([]service.ValueEncryptor{primary}, others...) {
+		if _, exists := e.encryptors[encryptor.Algorithm()]; !exists {
+			e.encryptors[encryptor.Algorithm()] = encryptor
+		}
+		if deterministic, ok := encryptor.(service.DeterministicEncryptor); ok && e.deterministic == nil {
+			e.deterministic = deterministic
+		}
+	}
+
+	return e
+}
+
+func (e *DispatchingEncryptor) Encrypt(data map[string]interface{}) (map[string]interface{}, error) {
+	return service.EncryptValues(e, data, "")
+}
+
+func (e *DispatchingEncryptor) Decrypt(data map[string]interface{}) (map[string]interface{}, error) {
+	return service.DecryptValues(e, data, "")
+}
+
+func (e *DispatchingEncryptor) Algorithm() string {
+	return e.primary.Algorithm()
+}
+
+func (e *DispatchingEncryptor) EncryptValue(binding service.Binding, value interface{}) (string, error) {
+	return e.primary.EncryptValue(binding, value)
+}
+
+func (e *DispatchingEncryptor) EncryptValueDeterministically(binding service.Binding, value interface{}) (string, error) {
+	if e.deterministic == nil {
+		return "", service.ErrDeterministicUnsupported
+	}
+	return e.deterministic.EncryptValueDeterministically(binding, value)
+}
+
+func (e *DispatchingEncryptor) DecryptValue(binding service.Binding, ciphertext string) (interface{}, error) {
+	if !IsEnvelope(ciphertext) {
+		return e.primary.DecryptValue(binding, ciphertext)
+	}
+
+	envelope, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptor, ok := e.encryptors[envelope.Algorithm]
+	if !ok {
+		return nil, invalidCiphertext("unsupported algorithm " + envelope.Algorithm)
+	}
+	return encryptor.DecryptValue(binding, ciphertext)
+}
+
+func (e *DispatchingEncryptor) Recognizes(ciphertext string) bool {
+	if !IsEnvelope(ciphertext) {
+		return false
+	}
+
+	envelope, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		return false
+	}
+	_, ok := e.encryptors[envelope.Algorithm]
+	return ok
+}
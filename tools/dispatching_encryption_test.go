@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"encoding/json"
+	"riot-api/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchingEncryptor_Encrypt_UsesPrimary(t *testing.T) {
+	// Prepare
+	aesEncryptor, _ := NewAESEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	encryptor := NewDispatchingEncryptor(aesEncryptor, NewBase64Encryptor())
+
+	// Perform
+	encryptedData, err := encryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+
+	// Check
+	assert.NoError(t, err)
+	envelope, err := ParseEnvelope(encryptedData["key1"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, AES256GCMAlgorithm, envelope.Algorithm)
+	assert.Equal(t, AES256GCMAlgorithm, encryptor.Algorithm())
+}
+
+func TestDispatchingEncryptor_Decrypt_DispatchesByAlgorithm(t *testing.T) {
+	// Prepare: values produced by both algorithms
+	aesEncryptor, _ := NewAESEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	aesCiphertext, _ := aesEncryptor.EncryptValue(service.KeyBinding("key1", ""), "value1")
+	encryptor := NewDispatchingEncryptor(aesEncryptor, NewBase64Encryptor())
+	data := map[string]interface{}{
+		"key1": aesCiphertext,
+		"key2": "riot:v1:base64::MTIz",
+	}
+
+	// Perform
+	decryptedData, err := encryptor.Decrypt(data)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", decryptedData["key1"])
+	assert.Equal(t, json.Number("123"), decryptedData["key2"])
+}
+
+func TestDispatchingEncryptor_Decrypt_LegacyValueUsesPrimary(t *testing.T) {
+	// Prepare
+	encryptor := NewDispatchingEncryptor(NewBase64Encryptor())
+
+	// Perform
+	decryptedData, err := encryptor.Decrypt(map[string]interface{}{"key1": "InZhbHVlMSI="})
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", decryptedData["key1"])
+}
+
+func TestDispatchingEncryptor_Decrypt_RejectsForeignValues(t *testing.T) {
+	// Prepare
+	encryptor := NewDispatchingEncryptor(NewBase64Encryptor())
+	foreignValues := []string{
+		"riot:v1:aes-256-gcm::AAAA",
+		"riot:v9:base64::InZhbHVlMSI=",
+		"riot:garbage",
+	}
+
+	for _, value := range foreignValues {
+		// Perform
+		_, err := encryptor.Decrypt(map[string]interface{}{"key1": value})
+
+		// Check
+		assert.Error(t, err, value)
+	}
+}
+
+func TestDispatchingEncryptor_Recognizes(t *testing.T) {
+	// Prepare
+	aesEncryptor, _ := NewAESEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	aesCiphertext, _ := aesEncryptor.EncryptValue(service.KeyBinding("key1", ""), "value1")
+	encryptor := NewDispatchingEncryptor(NewBase64Encryptor())
+
+	// Perform & Check: only valid envelopes of configured algorithms are recognised
+	assert.True(t, encryptor.Recognizes("riot:v1:base64::InZhbHVlMSI="))
+	assert.False(t, encryptor.Recognizes(aesCiphertext))
+	assert.False(t, encryptor.Recognizes("InZhbHVlMSI="))
+	assert.False(t, encryptor.Recognizes("riot:garbage"))
+	assert.False(t, encryptor.Recognizes("plain"))
+}
+
+func TestDispatchingEncryptor_EncryptValueDeterministically(t *testing.T) {
+	// Prepare
+	aesEncryptor, _ := NewAESEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	sivEncryptor, _ := NewAESSIVEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	encryptor := NewDispatchingEncryptor(aesEncryptor, NewBase64Encryptor(), sivEncryptor)
+
+	// Perform
+	ciphertext, err := encryptor.EncryptValueDeterministically(service.KeyBinding("email", ""), "ann@example.com")
+	_, errUnsupported := NewDispatchingEncryptor(aesEncryptor).EncryptValueDeterministically(service.KeyBinding("email", ""), "ann@example.com")
+
+	// Check
+	assert.NoError(t, err)
+	envelope, _ := ParseEnvelope(ciphertext)
+	assert.Equal(t, AESSIVAlgorithm, envelope.Algorithm)
+	assert.ErrorIs(t, errUnsupported, service.ErrDeterministicUnsupported)
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"riot-api/canonicalizer"
+	"riot-api/service"
+)
+
+const ECDSAP256Algorithm = "ecdsa-p256"
+
+// ECDSASigner signs the SHA-256 digest of the payload with an ECDSA P-256 key.
+// Signatures are ASN.1 DER encoded.
+type ECDSASigner struct {
+	keys signingKeys[*ecdsa.PrivateKey]
+}
+
+func NewECDSASigner(privateKey *ecdsa.PrivateKey) (*ECDSASigner, error) {
+	if _, err := checkECDSAKey(privateKey); err != nil {
+		return nil, err
+	}
+
+	return &ECDSASigner{keys: newSigningKey(privateKey)}, nil
+}
+
+// NewECDSAKeyringSigner signs with the active private key of the keyring and verifies with the
+// key whose ID prefixes the signature.
+func NewECDSAKeyringSigner(keyring *Keyring) (*ECDSASigner, error) {
+	keys, err := parseSigningKeys(keyring, checkECDSAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ECDSASigner{keys: keys}, nil
+}
+
+func checkECDSAKey(key crypto.Signer) (*ecdsa.PrivateKey, error) {
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA key")
+	}
+	if privateKey.Curve != elliptic.P256() {
+		return nil, errors.New("ECDSA key must use the P-256 curve")
+	}
+	return privateKey, nil
+}
+
+func (s *ECDSASigner) Sign(data interface{}) (string, error) {
+	dataBytes, err := canonicalizer.CanonicalizeExact(data)
+	if err != nil {
+		return "", &signingError{cause: err}
+	}
+
+	activeID, privateKey := s.keys.active()
+	digest := sha256.Sum256(dataBytes)
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed signing")
+	}
+
+	return joinKeyID(activeID, base64.StdEncoding.EncodeToString(signature)), nil
+}
+
+func (s *ECDSASigner) Verify(data interface{}, signature string) (service.VerificationResult, error) {
+	keyID, privateKey, signature, ok := s.keys.forSignature(signature)
+	if !ok {
+		return service.VerificationResult{Reason: service.ReasonUnknownKey, KeyID: keyID}, nil
+	}
+
+	dataBytes, err := canonicalizer.CanonicalizeExact(data)
+	if err != nil {
+		return service.VerificationResult{}, fmt.Errorf("failed verifying")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(decoded) == 0 {
+		return service.VerificationResult{Reason: service.ReasonMalformedSignature, KeyID: keyID}, nil
+	}
+
+	digest := sha256.Sum256(dataBytes)
+	if !ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], decoded) {
+		return service.VerificationResult{Reason: service.ReasonMismatch, KeyID: keyID}, nil
+	}
+
+	return service.VerificationResult{Valid: true, KeyID: keyID}, nil
+}
+
+func (s *ECDSASigner) Algorithm() string {
+	return ECDSAP256Algorithm
+}
+
+func (s *ECDSASigner) PublicKeys() ([]service.PublicKey, error) {
+	return s.keys.publicKeys()
+}
@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"riot-api/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestECDSASigner(t *testing.T) *ECDSASigner {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	signer, err := NewECDSASigner(privateKey)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return signer
+}
+
+func TestECDSASigner_NewECDSASigner_InvalidCurve(t *testing.T) {
+	// Prepare
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	// Perform
+	_, err := NewECDSASigner(privateKey)
+
+	// Check
+	assert.Error(t, err)
+}
+
+func TestECDSASigner_Sign_Verify(t *testing.T) {
+	// Prepare
+	signer := newTestECDSASigner(t)
+	data := map[string]interface{}{
+		"key1": "value1",
+		"key2": []interface{}{333, "value4"},
+	}
+
+	// Perform
+	signature, err := signer.Sign(data)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	result, err := signer.Verify(data, signature)
+
+	// Check
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestECDSASigner_Verify_Wrong_Signature(t *testing.T) {
+	// Prepare
+	signer1 := newTestECDSASigner(t)
+	signer2 := newTestECDSASigner(t)
+	data := map[string]interface{}{"key1": "value1"}
+	signature2, _ := signer2.Sign(data)
+
+	// Perform
+	result, err := signer1.Verify(data, signature2)
+
+	// Check
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, service.ReasonMismatch, result.Reason)
+}
+
+func TestECDSASigner_Verify_MalformedSignature(t *testing.T) {
+	// Prepare
+	signer := newTestECDSASigner(t)
+
+	// Perform
+	result, err := signer.Verify(map[string]interface{}{"key1": "value1"}, "not base64!")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, service.ReasonMalformedSignature, result.Reason)
+}
+
+func TestECDSASigner_KeyRotation(t *testing.T) {
+	// Prepare: rotate to v2, keeping the SEC 1 key v1 as retired
+	keyV1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keyV2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sec1V1, _ := x509.MarshalECPrivateKey(keyV1)
+	pkcs8V2, _ := x509.MarshalPKCS8PrivateKey(keyV2)
+	keyring := newTestKeyring(t, "v2", map[string]string{
+		"v1": string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1V1})),
+		"v2": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8V2})),
+	})
+	signer, err := NewECDSAKeyringSigner(keyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	oldSigner, _ := NewECDSASigner(keyV1)
+	data := map[string]interface{}{"key1": "value1"}
+	oldSignature, _ := oldSigner.Sign(data)
+
+	// Perform
+	newSignature, _ := signer.Sign(data)
+	oldResult, _ := signer.Verify(data, "v1"+KeyIDSeparator+oldSignature)
+	newResult, _ := signer.Verify(data, newSignature)
+
+	// Check
+	assert.True(t, strings.HasPrefix(newSignature, "v2:"))
+	assert.True(t, oldResult.Valid)
+	assert.Equal(t, "v1", oldResult.KeyID)
+	assert.True(t, newResult.Valid)
+	assert.Equal(t, "v2", newResult.KeyID)
+}
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"riot-api/canonicalizer"
+	"riot-api/service"
+)
+
+const Ed25519Algorithm = "ed25519"
+
+type Ed25519Signer struct {
+	keys signingKeys[ed25519.PrivateKey]
+}
+
+func NewEd25519Signer(privateKey ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{keys: newSigningKey(privateKey)}
+}
+
+// NewEd25519KeyringSigner signs with the active private key of the keyring and verifies with the
+// key whose ID prefixes the signature.
+func NewEd25519KeyringSigner(keyring *Keyring) (*Ed25519Signer, error) {
+	keys, err := parseSigningKeys(keyring, func(key crypto.Signer) (ed25519.PrivateKey, error) {
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an Ed25519 key")
+		}
+		return privateKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519Signer{keys: keys}, nil
+}
+
+func (s *Ed25519Signer) Sign(data interface{}) (string, error) {
+	dataBytes, err := canonicalizer.CanonicalizeExact(data)
+	if err != nil {
+		return "", &signingError{cause: err}
+	}
+
+	activeID, privateKey := s.keys.active()
+	signature := ed25519.Sign(privateKey, dataBytes)
+	return joinKeyID(activeID, base64.StdEncoding.EncodeToString(signature)), nil
+}
+
+func (s *Ed25519Signer) Verify(data interface{}, signature string) (service.VerificationResult, error) {
+	keyID, privateKey, signature, ok := s.keys.forSignature(signature)
+	if !ok {
+		return service.VerificationResult{Reason: service.ReasonUnknownKey, KeyID: keyID}, nil
+	}
+
+	dataBytes, err := canonicalizer.CanonicalizeExact(data)
+	if err != nil {
+		return service.VerificationResult{}, fmt.Errorf("failed verifying")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(decoded) != ed25519.SignatureSize {
+		return service.VerificationResult{Reason: service.ReasonMalformedSignature, KeyID: keyID}, nil
+	}
+
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	if !ed25519.Verify(publicKey, dataBytes, decoded) {
+		return service.VerificationResult{Reason: service.ReasonMismatch, KeyID: keyID}, nil
+	}
+
+	return service.VerificationResult{Valid: true, KeyID: keyID}, nil
+}
+
+func (s *Ed25519Signer) Algorithm() string {
+	return Ed25519Algorithm
+}
+
+func (s *Ed25519Signer) PublicKeys() ([]service.PublicKey, error) {
+	return s.keys.publicKeys()
+}
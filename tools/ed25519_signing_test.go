@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"riot-api/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEd25519Signer(t *testing.T) *Ed25519Signer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return NewEd25519Signer(privateKey)
+}
+
+func TestEd25519Signer_Sign_Verify(t *testing.T) {
+	// Prepare
+	signer := newTestEd25519Signer(t)
+	data := map[string]interface{}{
+		"key1": "value1",
+		"key2": 123,
+	}
+
+	// Perform
+	signature, err := signer.Sign(data)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	result, err := signer.Verify(data, signature)
+
+	// Check
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestEd25519Signer_Verify_Wrong_Data(t *testing.T) {
+	// Prepare
+	signer := newTestEd25519Signer(t)
+	signature, err := signer.Sign(map[string]interface{}{"key1": "value1"})
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Perform
+	result, err := signer.Verify(map[string]interface{}{"key1": "wrongValue"}, signature)
+
+	// Check
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, service.ReasonMismatch, result.Reason)
+}
+
+func TestEd25519Signer_Verify_MalformedSignature(t *testing.T) {
+	// Prepare
+	signer := newTestEd25519Signer(t)
+
+	// Perform
+	result, err := signer.Verify(map[string]interface{}{"key1": "value1"}, "c2hvcnQ=")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, service.ReasonMalformedSignature, result.Reason)
+}
+
+func TestEd25519Signer_Sign_InvalidJSON(t *testing.T) {
+	// Prepare
+	signer := newTestEd25519Signer(t)
+
+	// Perform
+	_, err := signer.Sign(map[string]interface{}{"key1": func() {}})
+
+	// Check
+	assert.EqualError(t, err, "failed signing")
+}
+
+func TestEd25519Signer_KeyRotation(t *testing.T) {
+	// Prepare: sign with v1, then rotate to v2 and keep v1 as retired
+	_, keyV1, _ := ed25519.GenerateKey(rand.Reader)
+	_, keyV2, _ := ed25519.GenerateKey(rand.Reader)
+	oldKeyring, _ := NewKeyring("v1", []byte(base64.StdEncoding.EncodeToString(keyV1.Seed())))
+	oldSigner, err := NewEd25519KeyringSigner(oldKeyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	data := map[string]interface{}{"key1": "value1"}
+	oldSignature, _ := oldSigner.Sign(data)
+
+	keyring := newTestKeyring(t, "v2", map[string]string{
+		"v1": base64.StdEncoding.EncodeToString(keyV1.Seed()),
+		"v2": base64.StdEncoding.EncodeToString(keyV2.Seed()),
+	})
+	signer, err := NewEd25519KeyringSigner(keyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Perform
+	newSignature, _ := signer.Sign(data)
+	oldResult, _ := signer.Verify(data, oldSignature)
+	newResult, _ := signer.Verify(data, newSignature)
+	unknownResult, _ := signer.Verify(data, "v9"+KeyIDSeparator+newSignature[len("v2"+KeyIDSeparator):])
+	publicKeys, err := signer.PublicKeys()
+
+	// Check
+	assert.True(t, strings.HasPrefix(newSignature, "v2:"))
+	assert.True(t, oldResult.Valid)
+	assert.Equal(t, "v1", oldResult.KeyID)
+	assert.True(t, newResult.Valid)
+	assert.Equal(t, "v2", newResult.KeyID)
+	assert.Equal(t, service.ReasonUnknownKey, unknownResult.Reason)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v2", "v1"}, []string{publicKeys[0].KeyID, publicKeys[1].KeyID})
+	publicKeyV1, _ := encodePublicKeyPEM(keyV1.Public())
+	assert.Equal(t, publicKeyV1, publicKeys[1].PEM)
+}
+
+func TestEd25519KeyringSigner_OtherKeyType(t *testing.T) {
+	// Prepare
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	keyring, _ := NewKeyring("v1", []byte(base64.StdEncoding.EncodeToString(der)))
+
+	// Perform
+	_, err := NewEd25519KeyringSigner(keyring)
+
+	// Check
+	assert.ErrorContains(t, err, `signing key "v1"`)
+}
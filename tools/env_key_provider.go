@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"fmt"
+	"riot-api/service"
+	"sort"
+	"strings"
+)
+
+// EnvKeyProvider reads keys from the <PURPOSE>_KEY, <PURPOSE>_KEY_ID and <PURPOSE>_RETIRED_KEYS
+// environment variables, for example SIGNING_KEY. The variables are read on every call.
+type EnvKeyProvider struct {
+	getenv func(string) string
+}
+
+// NewEnvKeyProvider reads variables with getenv, usually os.Getenv.
+func NewEnvKeyProvider(getenv func(string) string) *EnvKeyProvider {
+	return &EnvKeyProvider{getenv: getenv}
+}
+
+func (p *EnvKeyProvider) GetKey(purpose string, id string) (service.Key, error) {
+	keys, err := p.ListKeys(purpose)
+	if err != nil {
+		return service.Key{}, err
+	}
+	return findKey(keys, purpose, id)
+}
+
+func (p *EnvKeyProvider) ActiveKey(purpose string) (service.Key, error) {
+	prefix := strings.ToUpper(purpose)
+	material := p.getenv(prefix + "_KEY")
+	if material == "" {
+		return service.Key{}, fmt.Errorf("%w: %s_KEY is not set", service.ErrNoActiveKey, prefix)
+	}
+
+	id := p.getenv(prefix + "_KEY_ID")
+	if !keyIDPattern.MatchString(id) {
+		return service.Key{}, fmt.Errorf("%s_KEY_ID: invalid key ID %q", prefix, id)
+	}
+	return service.Key{ID: id, Purpose: purpose, Material: []byte(material)}, nil
+}
+
+func (p *EnvKeyProvider) ListKeys(purpose string) ([]service.Key, error) {
+	active, err := p.ActiveKey(purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.ToUpper(purpose)
+	retiredKeys, err := ParseKeyList(p.getenv(prefix + "_RETIRED_KEYS"))
+	if err != nil {
+		return nil, fmt.Errorf("%s_RETIRED_KEYS: %w", prefix, err)
+	}
+
+	keys := []service.Key{active}
+	for id, material := range retiredKeys {
+		if id == active.ID {
+			return nil, fmt.Errorf("%s_RETIRED_KEYS: duplicate key ID %q", prefix, id)
+		}
+		keys = append(keys, service.Key{ID: id, Purpose: purpose, Material: []byte(material)})
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func findKey(keys []service.Key, purpose string, id string) (service.Key, error) {
+	for _, key := range keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return service.Key{}, fmt.Errorf("%w %q for %s", service.ErrUnknownKey, id, purpose)
+}
+
+func sortKeys(keys []service.Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+}
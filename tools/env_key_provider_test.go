@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"riot-api/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGetenv(variables map[string]string) func(string) string {
+	return func(name string) string {
+		return variables[name]
+	}
+}
+
+func TestEnvKeyProvider_ListKeys(t *testing.T) {
+	// Prepare
+	provider := NewEnvKeyProvider(testGetenv(map[string]string{
+		"SIGNING_KEY":          "key-v2",
+		"SIGNING_KEY_ID":       "v2",
+		"SIGNING_RETIRED_KEYS": "v1=key-v1",
+	}))
+
+	// Perform
+	keys, err := provider.ListKeys(service.PurposeSigning)
+	active, errActive := provider.ActiveKey(service.PurposeSigning)
+	retired, errRetired := provider.GetKey(service.PurposeSigning, "v1")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, []service.Key{
+		{ID: "v1", Purpose: service.PurposeSigning, Material: []byte("key-v1")},
+		{ID: "v2", Purpose: service.PurposeSigning, Material: []byte("key-v2")},
+	}, keys)
+	assert.NoError(t, errActive)
+	assert.Equal(t, "v2", active.ID)
+	assert.NoError(t, errRetired)
+	assert.Equal(t, []byte("key-v1"), retired.Material)
+}
+
+func TestEnvKeyProvider_Errors(t *testing.T) {
+	// Prepare
+	provider := NewEnvKeyProvider(testGetenv(map[string]string{
+		"SIGNING_KEY":             "key-v2",
+		"SIGNING_KEY_ID":          "v2",
+		"SIGNING_RETIRED_KEYS":    "v2=key-v1",
+		"ENCRYPTION_KEY":          AES_256_GCM_ENCRYPTION_KEY,
+		"ENCRYPTION_KEY_ID":       "not:valid",
+		"ENCRYPTION_RETIRED_KEYS": "",
+	}))
+
+	// Perform
+	_, errNoKey := NewEnvKeyProvider(testGetenv(nil)).ActiveKey(service.PurposeEncryption)
+	_, errUnknown := NewEnvKeyProvider(testGetenv(map[string]string{"SIGNING_KEY": "key"})).GetKey(service.PurposeSigning, "v9")
+	_, errDuplicate := provider.ListKeys(service.PurposeSigning)
+	_, errInvalidID := provider.ActiveKey(service.PurposeEncryption)
+
+	// Check
+	assert.ErrorIs(t, errNoKey, service.ErrNoActiveKey)
+	assert.ErrorIs(t, errUnknown, service.ErrUnknownKey)
+	assert.Error(t, errDuplicate)
+	assert.Error(t, errInvalidID)
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	EnvelopePrefix = "riot"
+	// EnvelopeV1 is the envelope version. AEAD payloads are authenticated along with the path of
+	// their field and their context, and wrapped data keys along with a fixed label.
+	EnvelopeV1 = "v1"
+)
+
+// Envelope is the self-describing format of the values produced by the encryptors:
+//
+//	riot:<version>:<algorithm>:<key id>:<payload>
+//
+// The key ID is empty for algorithms without keys, or keys without an ID.
+type Envelope struct {
+	Version   string
+	Algorithm string
+	KeyID     string
+	Payload   string
+}
+
+func (e Envelope) String() string {
+	version := e.Version
+	if version == "" {
+		version = EnvelopeV1
+	}
+	return strings.Join([]string{EnvelopePrefix, version, e.Algorithm, e.KeyID, e.Payload}, ":")
+}
+
+// IsEnvelope reports whether value claims to be an envelope, without validating it.
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, EnvelopePrefix+":")
+}
+
+func ParseEnvelope(value string) (Envelope, error) {
+	parts := strings.SplitN(value, ":", 5)
+	if len(parts) != 5 || parts[0] != EnvelopePrefix {
+		return Envelope{}, invalidCiphertext("invalid envelope")
+	}
+	if parts[1] != EnvelopeV1 {
+		return Envelope{}, invalidCiphertext(fmt.Sprintf("unsupported envelope version %q", parts[1]))
+	}
+
+	envelope := Envelope{Version: parts[1], Algorithm: parts[2], KeyID: parts[3], Payload: parts[4]}
+	if envelope.Algorithm == "" || envelope.Payload == "" || !keyIDPattern.MatchString(envelope.KeyID) {
+		return Envelope{}, invalidCiphertext("invalid envelope")
+	}
+	return envelope, nil
+}
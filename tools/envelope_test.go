@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope_String(t *testing.T) {
+	// Prepare
+	envelope := Envelope{Version: EnvelopeV1, Algorithm: AES256GCMAlgorithm, KeyID: "k1", Payload: "InZhbHVlMSI="}
+
+	// Perform & Check
+	assert.Equal(t, "riot:v1:aes-256-gcm:k1:InZhbHVlMSI=", envelope.String())
+	assert.Equal(t, "riot:v1:base64::InZhbHVlMSI=", Envelope{Algorithm: Base64Algorithm, Payload: "InZhbHVlMSI="}.String())
+}
+
+func TestParseEnvelope(t *testing.T) {
+	// Perform
+	envelope, err := ParseEnvelope("riot:v1:base64::InZhbHVlMSI=")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, Envelope{Version: EnvelopeV1, Algorithm: Base64Algorithm, KeyID: "", Payload: "InZhbHVlMSI="}, envelope)
+}
+
+func TestParseEnvelope_Invalid(t *testing.T) {
+	invalidValues := []string{
+		"InZhbHVlMSI=",
+		"riot:v1:base64:InZhbHVlMSI=",
+		"riot:v9:base64::InZhbHVlMSI=",
+		"riot:v1:::InZhbHVlMSI=",
+		"riot:v1:base64::",
+		"riot:v1:base64:bad key:InZhbHVlMSI=",
+	}
+
+	for _, value := range invalidValues {
+		// Perform
+		_, err := ParseEnvelope(value)
+
+		// Check
+		assert.Error(t, err, value)
+	}
+}
+
+func TestIsEnvelope(t *testing.T) {
+	assert.True(t, IsEnvelope("riot:v1:base64::InZhbHVlMSI="))
+	assert.False(t, IsEnvelope("InZhbHVlMSI="))
+}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"riot-api/service"
+)
+
+// FileKeyProvider serves keys from a JSON keyring file, read once when the provider is created:
+//
+//	{
+//	  "signing": {"active": "v2", "keys": {"v1": "...", "v2": "..."}},
+//	  "encryption": {"active": "v1", "keys": {"v1": "..."}}
+//	}
+type FileKeyProvider struct {
+	purposes map[string]keyringFileEntry
+}
+
+type keyringFileEntry struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var purposes map[string]keyringFileEntry
+	if err := json.Unmarshal(content, &purposes); err != nil {
+		return nil, fmt.Errorf("invalid keyring file: %w", err)
+	}
+
+	for purpose, entry := range purposes {
+		for id := range entry.Keys {
+			if !keyIDPattern.MatchString(id) {
+				return nil, fmt.Errorf("invalid key ID %q for %s", id, purpose)
+			}
+		}
+		if _, ok := entry.Keys[entry.Active]; !ok {
+			return nil, fmt.Errorf("active key %q for %s is not in the keyring file", entry.Active, purpose)
+		}
+	}
+	return &FileKeyProvider{purposes: purposes}, nil
+}
+
+func (p *FileKeyProvider) GetKey(purpose string, id string) (service.Key, error) {
+	material, ok := p.purposes[purpose].Keys[id]
+	if !ok {
+		return service.Key{}, fmt.Errorf("%w %q for %s", service.ErrUnknownKey, id, purpose)
+	}
+	return service.Key{ID: id, Purpose: purpose, Material: []byte(material)}, nil
+}
+
+func (p *FileKeyProvider) ActiveKey(purpose string) (service.Key, error) {
+	entry, ok := p.purposes[purpose]
+	if !ok {
+		return service.Key{}, fmt.Errorf("%w for %s in the keyring file", service.ErrNoActiveKey, purpose)
+	}
+	return p.GetKey(purpose, entry.Active)
+}
+
+func (p *FileKeyProvider) ListKeys(purpose string) ([]service.Key, error) {
+	entry, ok := p.purposes[purpose]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s in the keyring file", service.ErrNoActiveKey, purpose)
+	}
+
+	keys := make([]service.Key, 0, len(entry.Keys))
+	for id, material := range entry.Keys {
+		keys = append(keys, service.Key{ID: id, Purpose: purpose, Material: []byte(material)})
+	}
+	sortKeys(keys)
+	return keys, nil
+}
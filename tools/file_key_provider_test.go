@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"riot-api/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeyringFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return path
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	// Prepare
+	path := writeKeyringFile(t, `{
+		"signing": {"active": "v2", "keys": {"v1": "key-v1", "v2": "key-v2"}},
+		"encryption": {"active": "", "keys": {"": "`+AES_256_GCM_ENCRYPTION_KEY+`"}}
+	}`)
+
+	// Perform
+	provider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	keys, errList := provider.ListKeys(service.PurposeSigning)
+	active, errActive := provider.ActiveKey(service.PurposeEncryption)
+	_, errUnknown := provider.GetKey(service.PurposeSigning, "v3")
+
+	// Check
+	assert.NoError(t, errList)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "v1", keys[0].ID)
+	assert.NoError(t, errActive)
+	assert.Equal(t, "", active.ID)
+	assert.Equal(t, []byte(AES_256_GCM_ENCRYPTION_KEY), active.Material)
+	assert.ErrorIs(t, errUnknown, service.ErrUnknownKey)
+}
+
+func TestFileKeyProvider_MissingPurpose(t *testing.T) {
+	// Prepare
+	provider, _ := NewFileKeyProvider(writeKeyringFile(t, `{"signing": {"active": "v1", "keys": {"v1": "key-v1"}}}`))
+
+	// Perform
+	_, err := provider.ActiveKey(service.PurposeEncryption)
+
+	// Check
+	assert.ErrorIs(t, err, service.ErrNoActiveKey)
+}
+
+func TestNewFileKeyProvider_Invalid(t *testing.T) {
+	for _, content := range []string{
+		`not json`,
+		`{"signing": {"active": "v2", "keys": {"v1": "key-v1"}}}`,
+		`{"signing": {"active": "v:1", "keys": {"v:1": "key-v1"}}}`,
+	} {
+		// Perform
+		_, err := NewFileKeyProvider(writeKeyringFile(t, content))
+
+		// Check
+		assert.Error(t, err, content)
+	}
+
+	_, err := NewFileKeyProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -4,36 +4,74 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"riot-api/canonicalizer"
+	"riot-api/service"
 )
 
+const HMACSHA256Algorithm = "hmac-sha256"
+
 type HMACSigner struct {
-	SecretKey []byte
+	keyring *Keyring
 }
 
 func NewHMACSigner(key []byte) *HMACSigner {
-	return &HMACSigner{SecretKey: key}
+	keyring, _ := NewKeyring("", key)
+	return &HMACSigner{keyring: keyring}
+}
+
+// NewHMACKeyringSigner signs with the active key of the keyring and verifies with the key whose
+// ID prefixes the signature.
+func NewHMACKeyringSigner(keyring *Keyring) *HMACSigner {
+	return &HMACSigner{keyring: keyring}
 }
 
-func (s *HMACSigner) Sign(data map[string]interface{}) (string, error) {
-	dataBytes, err := json.Marshal(data)
+// Sign computes the HMAC-SHA256 of the RFC 8785 canonical form of data, so clients in other
+// languages can reproduce the signature byte for byte.
+func (s *HMACSigner) Sign(data interface{}) (string, error) {
+	activeID := s.keyring.ActiveID()
+	key, _ := s.keyring.Key(activeID)
+
+	mac, err := s.mac(key, data)
 	if err != nil {
-		return "", fmt.Errorf("failed signing")
+		return "", &signingError{cause: err}
 	}
 
-	h := hmac.New(sha256.New, s.SecretKey)
-	h.Write(dataBytes)
+	return joinKeyID(activeID, base64.StdEncoding.EncodeToString(mac)), nil
+}
+
+// Verify compares the decoded signature with the expected HMAC in constant time.
+func (s *HMACSigner) Verify(data interface{}, signature string) (service.VerificationResult, error) {
+	keyID, encodedMAC := splitKeyID(signature)
+	key, ok := s.keyring.Key(keyID)
+	if !ok {
+		return service.VerificationResult{Reason: service.ReasonUnknownKey, KeyID: keyID}, nil
+	}
 
-	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
-	return signature, nil
+	expectedMAC, err := s.mac(key, data)
+	if err != nil {
+		return service.VerificationResult{}, fmt.Errorf("failed verifying")
+	}
+
+	providedMAC, err := base64.StdEncoding.DecodeString(encodedMAC)
+	if err != nil || len(providedMAC) != sha256.Size {
+		return service.VerificationResult{Reason: service.ReasonMalformedSignature, KeyID: keyID}, nil
+	}
+
+	if !hmac.Equal(expectedMAC, providedMAC) {
+		return service.VerificationResult{Reason: service.ReasonMismatch, KeyID: keyID}, nil
+	}
+
+	return service.VerificationResult{Valid: true, KeyID: keyID}, nil
 }
 
-func (s *HMACSigner) Verify(data map[string]interface{}, signature string) (bool, error) {
-	expectedSignature, err := s.Sign(data)
+func (s *HMACSigner) mac(key []byte, data interface{}) ([]byte, error) {
+	dataBytes, err := canonicalizer.CanonicalizeExact(data)
 	if err != nil {
-		return false, fmt.Errorf("failed verifying")
+		return nil, err
 	}
 
-	return expectedSignature == signature, nil
+	h := hmac.New(sha256.New, key)
+	h.Write(dataBytes)
+	return h.Sum(nil), nil
 }
@@ -1,7 +1,14 @@
 package tools
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"os"
+	"riot-api/canonicalizer"
+	"riot-api/service"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -76,11 +83,11 @@ func TestHMACSigner_Verify_Positive(t *testing.T) {
 	}
 
 	// Positive validation: Verify with the correct signature
-	isValid, err := signer.Verify(data, signature)
+	result, err := signer.Verify(data, signature)
 	if err != nil {
 		t.Fatalf("expected no error, but got %v", err)
 	}
-	if !isValid {
+	if !result.Valid {
 		t.Fatal("expected signature to be valid")
 	}
 }
@@ -106,13 +113,14 @@ func TestHMACSigner_Verify_Wrong_Data(t *testing.T) {
 		"key2": "wrongValue",
 	}
 
-	isValid, err := signer.Verify(alteredData, signature)
+	result, err := signer.Verify(alteredData, signature)
 	if err != nil {
 		t.Fatalf("expected no error, but got %v", err)
 	}
-	if isValid {
+	if result.Valid {
 		t.Fatal("expected signature to be invalid for altered data")
 	}
+	assert.Equal(t, service.ReasonMismatch, result.Reason)
 
 }
 
@@ -134,13 +142,14 @@ func TestHMACSigner_Verify_Wrong_Signature(t *testing.T) {
 	}
 
 	// Check
-	isValid, err := signer1.Verify(data, signature2)
+	result, err := signer1.Verify(data, signature2)
 	if err != nil {
 		t.Fatalf("expected no error, but got %v", err)
 	}
-	if isValid {
+	if result.Valid {
 		t.Fatal("expected signature to be invalid for altered signature")
 	}
+	assert.Equal(t, service.ReasonMismatch, result.Reason)
 }
 
 func TestHMACSigner_Verify_InvalidJSON(t *testing.T) {
@@ -154,9 +163,156 @@ func TestHMACSigner_Verify_InvalidJSON(t *testing.T) {
 	}
 
 	// Perform
-	isValid, err := signer1.Verify(data, signature1)
+	result, err := signer1.Verify(data, signature1)
 
 	// Check
 	assert.Equal(t, err.Error(), "failed verifying")
-	assert.Equal(t, isValid, false)
+	assert.Equal(t, result.Valid, false)
+}
+
+func TestHMACSigner_Sign_CanonicalJSON(t *testing.T) {
+	// Prepare: payload as another language would serialize it per RFC 8785
+	secretKey := []byte(SIGNING_KEY_TEST_1)
+	signer := NewHMACSigner(secretKey)
+	data := map[string]interface{}{
+		"html":   "<a&b>",
+		"amount": 4.50,
+		"big":    1e30,
+	}
+	canonical := `{"amount":4.5,"big":1e+30,"html":"<a&b>"}`
+
+	h := hmac.New(sha256.New, secretKey)
+	h.Write([]byte(canonical))
+	expectedSignature := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	// Perform
+	signature, err := signer.Sign(data)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, expectedSignature, signature)
+}
+
+func TestHMACSigner_Verify_MalformedSignature(t *testing.T) {
+	// Prepare
+	secretKey := []byte(SIGNING_KEY_TEST_1)
+	signer := NewHMACSigner(secretKey)
+	data := map[string]interface{}{
+		"key1": "value1",
+	}
+
+	for _, signature := range []string{"not base64!", "c2hvcnQ=", ""} {
+		// Perform
+		result, err := signer.Verify(data, signature)
+
+		// Check
+		assert.NoError(t, err)
+		assert.False(t, result.Valid)
+		assert.Equal(t, service.ReasonMalformedSignature, result.Reason)
+	}
+}
+
+func TestHMACSigner_KeyRotation(t *testing.T) {
+	// Prepare: sign with v1, then rotate to v2 and keep v1 as retired
+	oldKeyring, _ := NewKeyring("v1", []byte(SIGNING_KEY_TEST_1))
+	oldSigner := NewHMACKeyringSigner(oldKeyring)
+	data := map[string]interface{}{
+		"key1": "value1",
+	}
+	oldSignature, err := oldSigner.Sign(data)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	keyring := newTestKeyring(t, "v2", map[string]string{"v1": SIGNING_KEY_TEST_1, "v2": SIGNING_KEY_TEST_2})
+	signer := NewHMACKeyringSigner(keyring)
+
+	// Perform
+	newSignature, err := signer.Sign(data)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	oldResult, _ := signer.Verify(data, oldSignature)
+	newResult, _ := signer.Verify(data, newSignature)
+
+	// Check
+	assert.True(t, strings.HasPrefix(newSignature, "v2:"))
+	assert.True(t, oldResult.Valid)
+	assert.Equal(t, "v1", oldResult.KeyID)
+	assert.True(t, newResult.Valid)
+	assert.Equal(t, "v2", newResult.KeyID)
+}
+
+func TestHMACSigner_Verify_UnknownKey(t *testing.T) {
+	// Prepare
+	keyring, _ := NewKeyring("v2", []byte(SIGNING_KEY_TEST_2))
+	signer := NewHMACKeyringSigner(keyring)
+	data := map[string]interface{}{
+		"key1": "value1",
+	}
+
+	// Perform
+	result, err := signer.Verify(data, "v1:cJPPgZbzRuRhQNR8loSgf1TEJgmIuk68yu1P+kWv1C4=")
+
+	// Check
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, service.ReasonUnknownKey, result.Reason)
+	assert.Equal(t, "v1", result.KeyID)
+}
+
+func TestHMACSigner_SignArraysAndScalars(t *testing.T) {
+	// Prepare
+	secretKey := []byte(SIGNING_KEY_TEST_1)
+	signer := NewHMACSigner(secretKey)
+
+	tests := map[string]interface{}{
+		`[{"a":1},"b"]`: []interface{}{map[string]interface{}{"a": float64(1)}, "b"},
+		`"value1"`:      "value1",
+		`1.5`:           1.5,
+	}
+
+	for canonical, data := range tests {
+		// Perform
+		signature, err := signer.Sign(data)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		result, _ := signer.Verify(data, signature)
+
+		// Check: the signature covers the canonical form of the whole document
+		mac := hmac.New(sha256.New, secretKey)
+		mac.Write([]byte(canonical))
+		assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), signature)
+		assert.True(t, result.Valid)
+	}
+}
+
+func TestHMACSigner_SignInexactNumber(t *testing.T) {
+	// Prepare
+	signer := NewHMACSigner([]byte(SIGNING_KEY_TEST_1))
+	data := map[string]interface{}{"id": json.Number("9007199254740993")}
+
+	// Perform
+	_, err := signer.Sign(data)
+	result, _ := signer.Verify(data, "cJPPgZbzRuRhQNR8loSgf1TEJgmIuk68yu1P+kWv1C4=")
+
+	// Check: the number is not silently rounded to 9007199254740992
+	assert.EqualError(t, err, "failed signing")
+	assert.ErrorIs(t, err, canonicalizer.ErrInexactNumber)
+	assert.False(t, result.Valid)
+}
+
+func TestHMACSigner_SignExactNumbers(t *testing.T) {
+	// Prepare
+	signer := NewHMACSigner([]byte(SIGNING_KEY_TEST_1))
+
+	// Perform
+	decoded, errDecoded := signer.Sign(map[string]interface{}{"id": json.Number("9007199254740992"), "price": json.Number("10.50")})
+	native, errNative := signer.Sign(map[string]interface{}{"id": float64(9007199254740992), "price": 10.5})
+
+	// Check
+	assert.NoError(t, errDecoded)
+	assert.NoError(t, errNative)
+	assert.Equal(t, native, decoded)
 }
@@ -0,0 +1,20 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// DecodeKey decodes a hex or base64 encoded key and checks that it is exactly size bytes long.
+func DecodeKey(encoded string, size int) ([]byte, error) {
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == size {
+		return key, nil
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == size {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("key must be %d bytes, hex or base64 encoded", size)
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeKey_Hex(t *testing.T) {
+	// Perform
+	key, err := DecodeKey(SIGNING_KEY_TEST_1, 32)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Len(t, key, 32)
+}
+
+func TestDecodeKey_Base64(t *testing.T) {
+	// Perform
+	key, err := DecodeKey("bXBJWlhDOXVFc1RlN2Y5ZzFmWFhNc3BYbGlPQ1dOT2c=", 32)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(AES_256_GCM_ENCRYPTION_KEY), key)
+}
+
+func TestDecodeKey_WrongSize(t *testing.T) {
+	// Perform
+	_, err := DecodeKey("00112233", 32)
+
+	// Check
+	assert.EqualError(t, err, "key must be 32 bytes, hex or base64 encoded")
+}
+
+func TestDecodeKey_InvalidEncoding(t *testing.T) {
+	// Perform
+	_, err := DecodeKey("not a key!", 32)
+
+	// Check
+	assert.Error(t, err)
+}
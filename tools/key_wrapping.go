@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"crypto/rand"
+	"io"
+	"riot-api/service"
+)
+
+// masterKeyInfo derives the master keys from the encryption keys, so wrapped data keys can never
+// be confused with values encrypted directly
+const masterKeyInfo = "riot-api master key"
+
+// dataKeyAssociatedData is authenticated along with every wrapped data key, in place of the binding
+// of a value
+var dataKeyAssociatedData = []byte("riot-api data key")
+
+// KeyWrapper generates AES-256-GCM data keys and wraps them with AES-256-GCM under master keys
+// derived from a keyring. Wrapped keys are envelopes of the same version as values, naming the
+// master key, so data keys wrapped under a retired master key can still be opened and rewrapped.
+type KeyWrapper struct {
+	masterKeys *aeadEncryptor
+}
+
+func NewKeyWrapper(keyring *Keyring) (*KeyWrapper, error) {
+	masterKeyring, err := keyring.Derive(masterKeyInfo, AES256KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKeys, err := newAEADEncryptor(AES256GCMAlgorithm, masterKeyring, newAESGCM)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyWrapper{masterKeys: masterKeys}, nil
+}
+
+func (w *KeyWrapper) NewDataKey() (service.Encryptor, string, error) {
+	dataKey := make([]byte, AES256KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, "", err
+	}
+
+	encryptor, err := NewAESEncryptor(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	wrappedKey, err := w.masterKeys.seal(dataKey, dataKeyAssociatedData)
+	if err != nil {
+		return nil, "", err
+	}
+	return encryptor, wrappedKey, nil
+}
+
+func (w *KeyWrapper) OpenDataKey(wrappedKey string) (service.Encryptor, error) {
+	dataKey, err := w.unwrap(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewAESEncryptor(dataKey)
+}
+
+func (w *KeyWrapper) Rewrap(wrappedKey string) (string, error) {
+	dataKey, err := w.unwrap(wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	return w.masterKeys.seal(dataKey, dataKeyAssociatedData)
+}
+
+func (w *KeyWrapper) unwrap(wrappedKey string) ([]byte, error) {
+	if !IsEnvelope(wrappedKey) {
+		return nil, invalidCiphertext("invalid wrapped key")
+	}
+
+	envelope, err := openEnvelope(AES256GCMAlgorithm, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := w.masterKeys.open(envelope.KeyID, envelope.Payload, dataKeyAssociatedData)
+	if err != nil {
+		return nil, err
+	}
+	if len(dataKey) != AES256KeySize {
+		return nil, invalidCiphertext("invalid wrapped key")
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"riot-api/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeyWrapper(t *testing.T, activeID string, retiredIDs ...string) *KeyWrapper {
+	keys := map[string]string{"v1": AES_256_GCM_ENCRYPTION_KEY, "v2": CHACHA20_ENCRYPTION_KEY}
+	keyringKeys := map[string]string{activeID: keys[activeID]}
+	for _, id := range retiredIDs {
+		keyringKeys[id] = keys[id]
+	}
+
+	wrapper, err := NewKeyWrapper(newTestKeyring(t, activeID, keyringKeys))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return wrapper
+}
+
+func TestKeyWrapper_NewDataKey(t *testing.T) {
+	// Prepare
+	wrapper := newTestKeyWrapper(t, "v1")
+
+	// Perform
+	encryptor, wrappedKey, err := wrapper.NewDataKey()
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	_, otherWrappedKey, _ := wrapper.NewDataKey()
+	encryptedData, _ := encryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+	opened, err := wrapper.OpenDataKey(wrappedKey)
+
+	// Check: every data key is fresh, and the unwrapped key decrypts
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(wrappedKey, "riot:v1:aes-256-gcm:v1:"))
+	assert.NotEqual(t, wrappedKey, otherWrappedKey)
+	decryptedData, err := opened.Decrypt(encryptedData)
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", decryptedData["key1"])
+}
+
+func TestKeyWrapper_Rewrap(t *testing.T) {
+	// Prepare: a data key wrapped under v1, then v2 becomes the active master key
+	encryptor, wrappedKey, _ := newTestKeyWrapper(t, "v1").NewDataKey()
+	encryptedData, _ := encryptor.Encrypt(map[string]interface{}{"key1": "value1"})
+	wrapper := newTestKeyWrapper(t, "v2", "v1")
+
+	// Perform
+	rewrappedKey, err := wrapper.Rewrap(wrappedKey)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	// Check: the rewrapped key opens without v1 and decrypts the same payload
+	assert.True(t, strings.HasPrefix(rewrappedKey, "riot:v1:aes-256-gcm:v2:"))
+	opened, err := newTestKeyWrapper(t, "v2").OpenDataKey(rewrappedKey)
+	assert.NoError(t, err)
+	decryptedData, err := opened.Decrypt(encryptedData)
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", decryptedData["key1"])
+}
+
+func TestKeyWrapper_OpenDataKey_Invalid(t *testing.T) {
+	// Prepare
+	wrapper := newTestKeyWrapper(t, "v1")
+	aesEncryptor, _ := NewAESEncryptor([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	encryptedValue, _ := aesEncryptor.EncryptValue(service.Binding{}, "value1")
+	_, wrappedKey, _ := wrapper.NewDataKey()
+
+	for _, invalid := range []string{"", "InZhbHVlMSI=", "riot:v1:base64::InZhbHVlMSI=", encryptedValue, strings.Replace(wrappedKey, ":aes-256-gcm:v1:", ":aes-256-gcm:v9:", 1)} {
+		// Perform
+		_, err := wrapper.OpenDataKey(invalid)
+		_, errRewrap := wrapper.Rewrap(invalid)
+
+		// Check
+		assert.Error(t, err, invalid)
+		assert.Error(t, errRewrap, invalid)
+	}
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"riot-api/service"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyIDSeparator separates the key ID from the ciphertext or signature it produced
+const KeyIDSeparator = ":"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+
+// Keyring holds one active key, used to encrypt and sign, and any number of retired keys that
+// are only used to decrypt and verify. Each key has an ID, so rotating the active key never
+// breaks values produced earlier.
+//
+// The empty ID is valid: values produced with it carry no key ID, which matches the format
+// used before key IDs were introduced.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+func NewKeyring(activeID string, activeKey []byte) (*Keyring, error) {
+	if !keyIDPattern.MatchString(activeID) {
+		return nil, fmt.Errorf("invalid key ID %q", activeID)
+	}
+
+	return &Keyring{
+		activeID: activeID,
+		keys:     map[string][]byte{activeID: activeKey},
+	}, nil
+}
+
+// NewKeyringFromProvider builds a keyring from the keys of a purpose, decoding each one. The active
+// key of the provider becomes the active key of the keyring.
+func NewKeyringFromProvider(provider service.KeyProvider, purpose string, decode func(material []byte) ([]byte, error)) (*Keyring, error) {
+	active, err := provider.ActiveKey(purpose)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := provider.ListKeys(purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := &Keyring{activeID: active.ID, keys: make(map[string][]byte, len(keys))}
+	for _, key := range keys {
+		if !keyIDPattern.MatchString(key.ID) {
+			return nil, fmt.Errorf("invalid key ID %q", key.ID)
+		}
+		decoded, err := decode(key.Material)
+		if err != nil {
+			return nil, fmt.Errorf("%s key %q: %w", purpose, key.ID, err)
+		}
+		keyring.keys[key.ID] = decoded
+	}
+	if _, ok := keyring.keys[active.ID]; !ok {
+		return nil, fmt.Errorf("active %s key %q is not listed", purpose, active.ID)
+	}
+	return keyring, nil
+}
+
+func (k *Keyring) ActiveID() string {
+	return k.activeID
+}
+
+func (k *Keyring) Key(id string) ([]byte, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// IDs returns the sorted IDs of every key in the keyring.
+func (k *Keyring) IDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Derive returns a keyring with the same IDs whose keys are derived from these ones with
+// HKDF-SHA256, so that a configured key can serve several purposes without being reused as is.
+// Each purpose must use its own info.
+func (k *Keyring) Derive(info string, size int) (*Keyring, error) {
+	derived := &Keyring{activeID: k.activeID, keys: make(map[string][]byte, len(k.keys))}
+	for id, key := range k.keys {
+		derivedKey := make([]byte, size)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(info)), derivedKey); err != nil {
+			return nil, err
+		}
+		derived.keys[id] = derivedKey
+	}
+	return derived, nil
+}
+
+// ParseKeyList parses a comma separated list of id=key pairs, as used in the
+// *_RETIRED_KEYS environment variables. The ID may be empty.
+func ParseKeyList(list string) (map[string]string, error) {
+	keys := make(map[string]string)
+	if strings.TrimSpace(list) == "" {
+		return keys, nil
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		id, key, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || key == "" {
+			return nil, errors.New("key list entries must be formatted as id=key")
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate key ID %q", id)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// splitKeyID splits a value produced by a keyring into its key ID and payload.
+// Values without a key ID belong to the key with the empty ID.
+func splitKeyID(value string) (string, string) {
+	if id, payload, found := strings.Cut(value, KeyIDSeparator); found {
+		return id, payload
+	}
+	return "", value
+}
+
+// joinKeyID prefixes a payload with the ID of the key that produced it.
+func joinKeyID(id, payload string) string {
+	if id == "" {
+		return payload
+	}
+	return id + KeyIDSeparator + payload
+}
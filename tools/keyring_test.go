@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"riot-api/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestKeyring returns a keyring whose active key is activeID, with the other keys retired, read
+// from the environment as at startup
+func newTestKeyring(t *testing.T, activeID string, keys map[string]string) *Keyring {
+	var retiredKeys []string
+	for id, key := range keys {
+		if id != activeID {
+			retiredKeys = append(retiredKeys, id+"="+key)
+		}
+	}
+	provider := NewEnvKeyProvider(testGetenv(map[string]string{
+		"ENCRYPTION_KEY":          keys[activeID],
+		"ENCRYPTION_KEY_ID":       activeID,
+		"ENCRYPTION_RETIRED_KEYS": strings.Join(retiredKeys, ","),
+	}))
+
+	keyring, err := NewKeyringFromProvider(provider, service.PurposeEncryption, func(material []byte) ([]byte, error) {
+		return material, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return keyring
+}
+
+func TestKeyring_ActiveAndRetiredKeys(t *testing.T) {
+	// Perform
+	keyring := newTestKeyring(t, "v2", map[string]string{"v1": "key-v1", "v2": "key-v2"})
+
+	// Check
+	assert.Equal(t, "v2", keyring.ActiveID())
+	assert.Equal(t, []string{"v1", "v2"}, keyring.IDs())
+
+	key, ok := keyring.Key("v1")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("key-v1"), key)
+
+	_, ok = keyring.Key("v3")
+	assert.False(t, ok)
+}
+
+func TestKeyring_InvalidKeyID(t *testing.T) {
+	// Perform
+	_, err := NewKeyring("v1:x", []byte("key"))
+
+	// Check
+	assert.Error(t, err)
+}
+
+func TestParseKeyList(t *testing.T) {
+	// Perform
+	keys, err := ParseKeyList("v1=bXBJWlhDOXVFc1RlN2Y5ZzFmWFhNc3BYbGlPQ1dOT2c=, =legacy")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"v1": "bXBJWlhDOXVFc1RlN2Y5ZzFmWFhNc3BYbGlPQ1dOT2c=",
+		"":   "legacy",
+	}, keys)
+}
+
+func TestParseKeyList_Empty(t *testing.T) {
+	// Perform
+	keys, err := ParseKeyList("")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestParseKeyList_Invalid(t *testing.T) {
+	for _, list := range []string{"v1", "v1=", "v1=a,v1=b"} {
+		// Perform
+		_, err := ParseKeyList(list)
+
+		// Check
+		assert.Error(t, err)
+	}
+}
+
+func TestNewKeyringFromProvider(t *testing.T) {
+	// Prepare
+	provider := NewEnvKeyProvider(testGetenv(map[string]string{
+		"ENCRYPTION_KEY":          AES_256_GCM_ENCRYPTION_KEY,
+		"ENCRYPTION_KEY_ID":       "v2",
+		"ENCRYPTION_RETIRED_KEYS": "v1=" + CHACHA20_ENCRYPTION_KEY,
+	}))
+	identity := func(material []byte) ([]byte, error) { return material, nil }
+
+	// Perform
+	keyring, err := NewKeyringFromProvider(provider, service.PurposeEncryption, identity)
+	_, errDecode := NewKeyringFromProvider(provider, service.PurposeEncryption, func(material []byte) ([]byte, error) {
+		return DecodeKey(string(material), 16)
+	})
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", keyring.ActiveID())
+	assert.Equal(t, []string{"v1", "v2"}, keyring.IDs())
+	key, _ := keyring.Key("v1")
+	assert.Equal(t, []byte(CHACHA20_ENCRYPTION_KEY), key)
+	assert.Error(t, errDecode)
+}
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"math"
+	"riot-api/service"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often buckets that refilled are forgotten
+const rateLimitSweepInterval = time.Minute
+
+// MemoryRateLimitStore keeps token buckets in process, so each replica has its own budgets.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket refills, after which it is the same as a new bucket
+	full time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit service.RateLimit) (service.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = bucket
+	}
+
+	tokens, result := takeToken(bucket.tokens, now.Sub(bucket.updated).Seconds(), limit)
+	bucket.tokens = tokens
+	bucket.updated = now
+	bucket.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep forgets the buckets that refilled, so memory only grows with the clients of the last
+// minute.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, bucket := range s.buckets {
+		if !bucket.full.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// takeToken refills a bucket holding tokens for the elapsed seconds, then takes a token from it
+// if it holds one. It returns the tokens left. The Redis store runs the same algorithm in Lua.
+func takeToken(tokens, elapsed float64, limit service.RateLimit) (float64, service.RateLimitResult) {
+	tokens = math.Min(float64(limit.Burst), tokens+math.Max(0, elapsed)*limit.Rate)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	return tokens, bucketResult(allowed, tokens, limit)
+}
+
+// bucketResult describes a bucket holding tokens after a request was allowed or not.
+func bucketResult(allowed bool, tokens float64, limit service.RateLimit) service.RateLimitResult {
+	result := service.RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"riot-api/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	// Prepare
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := service.RateLimit{Rate: 2, Burst: 3}
+
+	// Perform
+	var results []service.RateLimitResult
+	for i := 0; i < 4; i++ {
+		result, _ := store.Take(context.Background(), "ip:1.2.3.4", limit)
+		results = append(results, result)
+	}
+	other, _ := store.Take(context.Background(), "ip:5.6.7.8", limit)
+
+	now = now.Add(500 * time.Millisecond)
+	refilled, _ := store.Take(context.Background(), "ip:1.2.3.4", limit)
+
+	// Check
+	assert.Equal(t, service.RateLimitResult{Allowed: true, Remaining: 2, Reset: 500 * time.Millisecond}, results[0])
+	assert.Equal(t, service.RateLimitResult{Allowed: true, Remaining: 0, Reset: 1500 * time.Millisecond}, results[2])
+	assert.Equal(t, service.RateLimitResult{Allowed: false, Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: 1500 * time.Millisecond}, results[3])
+	assert.True(t, other.Allowed)
+	assert.True(t, refilled.Allowed)
+	assert.Equal(t, 0, refilled.Remaining)
+}
+
+func TestMemoryRateLimitStore_ForgetsRefilledBuckets(t *testing.T) {
+	// Prepare
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	store.Take(context.Background(), "ip:1.2.3.4", service.RateLimit{Rate: 1, Burst: 1})
+	store.Take(context.Background(), "ip:5.6.7.8", service.RateLimit{Rate: 0.01, Burst: 1})
+
+	// Perform
+	now = now.Add(rateLimitSweepInterval)
+	store.Take(context.Background(), "ip:9.9.9.9", service.RateLimit{Rate: 1, Burst: 1})
+
+	// Check
+	assert.NotContains(t, store.buckets, "ip:1.2.3.4")
+	assert.Contains(t, store.buckets, "ip:5.6.7.8")
+}
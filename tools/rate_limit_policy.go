@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"riot-api/service"
+)
+
+// LoadRateLimitPolicy reads a rate limit policy from a JSON file. The default limit, when
+// omitted, is service.DefaultRateLimit:
+//
+//	{
+//	  "default": {"rate": 1000, "burst": 1000},
+//	  "routes": {"/decrypt": {"rate": 100, "burst": 100}},
+//	  "identities": {
+//	    "api-key:billing": {"default": {"rate": 5000, "burst": 5000}, "routes": {"/decrypt": {"rate": 500, "burst": 500}}},
+//	    "ip:10.0.0.1": {"default": {"rate": 10, "burst": 10}}
+//	  }
+//	}
+func LoadRateLimitPolicy(path string) (service.RateLimitPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return service.RateLimitPolicy{}, err
+	}
+
+	var file struct {
+		Default    *service.RateLimit                    `json:"default"`
+		Routes     map[string]service.RateLimit          `json:"routes"`
+		Identities map[string]service.IdentityRateLimits `json:"identities"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return service.RateLimitPolicy{}, fmt.Errorf("invalid rate limits file: %w", err)
+	}
+
+	policy := service.RateLimitPolicy{Default: service.DefaultRateLimit, Routes: file.Routes, Identities: file.Identities}
+	if file.Default != nil {
+		policy.Default = *file.Default
+	}
+
+	if err := validateRateLimit(policy.Default, "default"); err != nil {
+		return service.RateLimitPolicy{}, err
+	}
+	for route, limit := range policy.Routes {
+		if err := validateRateLimit(limit, "route "+route); err != nil {
+			return service.RateLimitPolicy{}, err
+		}
+	}
+	for identity, limits := range policy.Identities {
+		if limits.Default != nil {
+			if err := validateRateLimit(*limits.Default, "identity "+identity); err != nil {
+				return service.RateLimitPolicy{}, err
+			}
+		}
+		for route, limit := range limits.Routes {
+			if err := validateRateLimit(limit, "identity "+identity+" route "+route); err != nil {
+				return service.RateLimitPolicy{}, err
+			}
+		}
+	}
+	return policy, nil
+}
+
+func validateRateLimit(limit service.RateLimit, name string) error {
+	if limit.Rate <= 0 || limit.Burst < 1 {
+		return fmt.Errorf("rate limit of %s must have a positive rate and burst", name)
+	}
+	return nil
+}
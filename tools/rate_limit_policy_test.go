@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"path/filepath"
+	"riot-api/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRateLimitPolicy(t *testing.T) {
+	// Prepare
+	path := writeKeyringFile(t, `{
+		"routes": {"/decrypt": {"rate": 10, "burst": 20}},
+		"identities": {"api-key:billing": {"default": {"rate": 5000, "burst": 5000}}}
+	}`)
+
+	// Perform
+	policy, err := LoadRateLimitPolicy(path)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, service.RateLimitPolicy{
+		Default:    service.DefaultRateLimit,
+		Routes:     map[string]service.RateLimit{"/decrypt": {Rate: 10, Burst: 20}},
+		Identities: map[string]service.IdentityRateLimits{"api-key:billing": {Default: &service.RateLimit{Rate: 5000, Burst: 5000}}},
+	}, policy)
+}
+
+func TestLoadRateLimitPolicy_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not JSON":         `not JSON`,
+		"unknown field":    `{"route": {"/decrypt": {"rate": 10, "burst": 10}}}`,
+		"zero rate":        `{"default": {"rate": 0, "burst": 10}}`,
+		"zero burst":       `{"routes": {"/decrypt": {"rate": 10, "burst": 0}}}`,
+		"negative rate":    `{"identities": {"api-key:billing": {"default": {"rate": -1, "burst": 10}}}}`,
+		"identity route":   `{"identities": {"api-key:billing": {"routes": {"/decrypt": {"rate": 10}}}}}`,
+		"default required": `{"default": {}}`,
+	}
+
+	for name, content := range tests {
+		// Perform
+		_, err := LoadRateLimitPolicy(writeKeyringFile(t, content))
+
+		// Check
+		assert.Error(t, err, name)
+	}
+
+	_, err := LoadRateLimitPolicy(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
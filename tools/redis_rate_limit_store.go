@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"riot-api/service"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisRateLimitKeyPrefix prefixes the keys of the buckets in Redis
+const RedisRateLimitKeyPrefix = "riot:ratelimit:"
+
+// takeTokenScript is takeToken run atomically in Redis, timed by the Redis clock so replicas with
+// skewed clocks agree. A bucket expires once it refilled, since a full bucket is the same as none.
+// The tokens left are returned as a string, because Redis truncates Lua numbers to integers.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimitStore keeps token buckets in Redis, so every replica using the same Redis shares
+// the budget of each key.
+type RedisRateLimitStore struct {
+	client redis.Scripter
+}
+
+func NewRedisRateLimitStore(client redis.Scripter) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit service.RateLimit) (service.RateLimitResult, error) {
+	reply, err := takeTokenScript.Run(ctx, s.client, []string{RedisRateLimitKeyPrefix + key}, limit.Rate, limit.Burst).Slice()
+	if err != nil {
+		return service.RateLimitResult{}, fmt.Errorf("redis rate limit: %w", err)
+	}
+
+	if len(reply) != 2 {
+		return service.RateLimitResult{}, fmt.Errorf("redis rate limit: unexpected reply %v", reply)
+	}
+	allowed, allowedOk := reply[0].(int64)
+	tokensText, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensText, 64)
+	if !allowedOk || err != nil {
+		return service.RateLimitResult{}, fmt.Errorf("redis rate limit: unexpected reply %v", reply)
+	}
+	return bucketResult(allowed == 1, tokens, limit), nil
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"riot-api/service"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	server.SetTime(time.Now())
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	// Prepare
+	server, client := newTestRedis(t)
+	store := NewRedisRateLimitStore(client)
+	limit := service.RateLimit{Rate: 2, Burst: 3}
+
+	// Perform
+	var results []service.RateLimitResult
+	for i := 0; i < 4; i++ {
+		result, err := store.Take(context.Background(), "ip:1.2.3.4", limit)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		results = append(results, result)
+	}
+	other, _ := store.Take(context.Background(), "ip:5.6.7.8", limit)
+
+	server.SetTime(time.Now().Add(500 * time.Millisecond))
+	refilled, _ := store.Take(context.Background(), "ip:1.2.3.4", limit)
+
+	// Check
+	assert.Equal(t, service.RateLimitResult{Allowed: true, Remaining: 2, Reset: 500 * time.Millisecond}, results[0])
+	assert.Equal(t, service.RateLimitResult{Allowed: true, Remaining: 0, Reset: 1500 * time.Millisecond}, results[2])
+	assert.Equal(t, service.RateLimitResult{Allowed: false, Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: 1500 * time.Millisecond}, results[3])
+	assert.True(t, other.Allowed)
+	assert.True(t, refilled.Allowed)
+	assert.True(t, server.Exists(RedisRateLimitKeyPrefix+"ip:1.2.3.4"))
+}
+
+func TestRedisRateLimitStore_SharedBetweenReplicas(t *testing.T) {
+	// Prepare
+	_, client := newTestRedis(t)
+	_, otherClient := newTestRedis(t)
+	replica := NewRedisRateLimitStore(client)
+	sameRedisReplica := NewRedisRateLimitStore(redis.NewClient(client.Options()))
+	otherRedisReplica := NewRedisRateLimitStore(otherClient)
+	limit := service.RateLimit{Rate: 1, Burst: 1}
+
+	// Perform
+	first, _ := replica.Take(context.Background(), "ip:1.2.3.4", limit)
+	second, _ := sameRedisReplica.Take(context.Background(), "ip:1.2.3.4", limit)
+	unshared, _ := otherRedisReplica.Take(context.Background(), "ip:1.2.3.4", limit)
+
+	// Check
+	assert.True(t, first.Allowed)
+	assert.False(t, second.Allowed)
+	assert.True(t, unshared.Allowed)
+}
+
+func TestRedisRateLimitStore_ExpiresRefilledBuckets(t *testing.T) {
+	// Prepare
+	server, client := newTestRedis(t)
+	store := NewRedisRateLimitStore(client)
+	store.Take(context.Background(), "ip:1.2.3.4", service.RateLimit{Rate: 1, Burst: 2})
+
+	// Perform
+	server.FastForward(2 * time.Second)
+
+	// Check
+	assert.False(t, server.Exists(RedisRateLimitKeyPrefix+"ip:1.2.3.4"))
+}
+
+func TestRedisRateLimitStore_Unavailable(t *testing.T) {
+	// Prepare
+	server, client := newTestRedis(t)
+	store := NewRedisRateLimitStore(client)
+	server.Close()
+
+	// Perform
+	_, err := store.Take(context.Background(), "ip:1.2.3.4", service.RateLimit{Rate: 1, Burst: 1})
+
+	// Check
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"riot-api/canonicalizer"
+	"riot-api/service"
+)
+
+const (
+	RSAPSSAlgorithm   = "rsa-pss-sha256"
+	RSAMinimumKeyBits = 2048
+)
+
+// RSAPSSSigner signs the SHA-256 digest of the payload with RSASSA-PSS,
+// using a salt as long as the digest.
+type RSAPSSSigner struct {
+	keys signingKeys[*rsa.PrivateKey]
+}
+
+func NewRSAPSSSigner(privateKey *rsa.PrivateKey) (*RSAPSSSigner, error) {
+	if _, err := checkRSAKey(privateKey); err != nil {
+		return nil, err
+	}
+
+	return &RSAPSSSigner{keys: newSigningKey(privateKey)}, nil
+}
+
+// NewRSAPSSKeyringSigner signs with the active private key of the keyring and verifies with the
+// key whose ID prefixes the signature.
+func NewRSAPSSKeyringSigner(keyring *Keyring) (*RSAPSSSigner, error) {
+	keys, err := parseSigningKeys(keyring, checkRSAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RSAPSSSigner{keys: keys}, nil
+}
+
+func checkRSAKey(key crypto.Signer) (*rsa.PrivateKey, error) {
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	if privateKey.N.BitLen() < RSAMinimumKeyBits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits", RSAMinimumKeyBits)
+	}
+	return privateKey, nil
+}
+
+var pssOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+
+func (s *RSAPSSSigner) Sign(data interface{}) (string, error) {
+	dataBytes, err := canonicalizer.CanonicalizeExact(data)
+	if err != nil {
+		return "", &signingError{cause: err}
+	}
+
+	activeID, privateKey := s.keys.active()
+	digest := sha256.Sum256(dataBytes)
+	signature, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, digest[:], pssOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed signing")
+	}
+
+	return joinKeyID(activeID, base64.StdEncoding.EncodeToString(signature)), nil
+}
+
+func (s *RSAPSSSigner) Verify(data interface{}, signature string) (service.VerificationResult, error) {
+	keyID, privateKey, signature, ok := s.keys.forSignature(signature)
+	if !ok {
+		return service.VerificationResult{Reason: service.ReasonUnknownKey, KeyID: keyID}, nil
+	}
+
+	dataBytes, err := canonicalizer.CanonicalizeExact(data)
+	if err != nil {
+		return service.VerificationResult{}, fmt.Errorf("failed verifying")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(decoded) != privateKey.Size() {
+		return service.VerificationResult{Reason: service.ReasonMalformedSignature, KeyID: keyID}, nil
+	}
+
+	digest := sha256.Sum256(dataBytes)
+	err = rsa.VerifyPSS(&privateKey.PublicKey, crypto.SHA256, digest[:], decoded, pssOptions)
+	if errors.Is(err, rsa.ErrVerification) {
+		return service.VerificationResult{Reason: service.ReasonMismatch, KeyID: keyID}, nil
+	} else if err != nil {
+		return service.VerificationResult{}, fmt.Errorf("failed verifying")
+	}
+
+	return service.VerificationResult{Valid: true, KeyID: keyID}, nil
+}
+
+func (s *RSAPSSSigner) Algorithm() string {
+	return RSAPSSAlgorithm
+}
+
+func (s *RSAPSSSigner) PublicKeys() ([]service.PublicKey, error) {
+	return s.keys.publicKeys()
+}
@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"riot-api/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRSAPSSSigner(t *testing.T) *RSAPSSSigner {
+	privateKey, err := rsa.GenerateKey(rand.Reader, RSAMinimumKeyBits)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	signer, err := NewRSAPSSSigner(privateKey)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return signer
+}
+
+func TestRSAPSSSigner_NewRSAPSSSigner_ShortKey(t *testing.T) {
+	// Prepare
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	// Perform
+	_, err := NewRSAPSSSigner(privateKey)
+
+	// Check
+	assert.Error(t, err)
+}
+
+func TestRSAPSSSigner_Sign_Verify(t *testing.T) {
+	// Prepare
+	signer := newTestRSAPSSSigner(t)
+	data := map[string]interface{}{
+		"key1": "value1",
+		"key2": 123.123,
+	}
+
+	// Perform
+	signature, err := signer.Sign(data)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	result, err := signer.Verify(data, signature)
+
+	// Check
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+
+	// Check: altered data is rejected
+	result, err = signer.Verify(map[string]interface{}{"key1": "value1"}, signature)
+	assert.NoError(t, err)
+	assert.Equal(t, service.ReasonMismatch, result.Reason)
+}
+
+func TestRSAPSSSigner_Verify_MalformedSignature(t *testing.T) {
+	// Prepare
+	signer := newTestRSAPSSSigner(t)
+
+	// Perform
+	result, err := signer.Verify(map[string]interface{}{"key1": "value1"}, "c2hvcnQ=")
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, service.ReasonMalformedSignature, result.Reason)
+}
+
+func TestRSAPSSSigner_KeyRotation(t *testing.T) {
+	// Prepare: rotate to v2, keeping the PKCS#1 key v1 as retired
+	keyV1, _ := rsa.GenerateKey(rand.Reader, RSAMinimumKeyBits)
+	keyV2, _ := rsa.GenerateKey(rand.Reader, RSAMinimumKeyBits)
+	pkcs8V2, _ := x509.MarshalPKCS8PrivateKey(keyV2)
+	keyring := newTestKeyring(t, "v2", map[string]string{
+		"v1": string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(keyV1)})),
+		"v2": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8V2})),
+	})
+	signer, err := NewRSAPSSKeyringSigner(keyring)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	oldSigner, _ := NewRSAPSSSigner(keyV1)
+	data := map[string]interface{}{"key1": "value1"}
+	oldSignature, _ := oldSigner.Sign(data)
+
+	// Perform
+	newSignature, _ := signer.Sign(data)
+	oldResult, _ := signer.Verify(data, "v1"+KeyIDSeparator+oldSignature)
+	newResult, _ := signer.Verify(data, newSignature)
+	publicKeys, err := signer.PublicKeys()
+
+	// Check
+	assert.True(t, strings.HasPrefix(newSignature, "v2:"))
+	assert.True(t, oldResult.Valid)
+	assert.Equal(t, "v1", oldResult.KeyID)
+	assert.True(t, newResult.Valid)
+	assert.NoError(t, err)
+	assert.Len(t, publicKeys, 2)
+}
@@ -0,0 +1,15 @@
+package tools
+
+// signingError keeps the generic message signers have always returned, while letting callers
+// match its cause, such as canonicalizer.ErrInexactNumber, with errors.Is.
+type signingError struct {
+	cause error
+}
+
+func (e *signingError) Error() string {
+	return "failed signing"
+}
+
+func (e *signingError) Unwrap() error {
+	return e.cause
+}
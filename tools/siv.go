@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// siv implements the SIV mode of RFC 5297 with AES: a synthetic IV is derived from the
+// associated data and the plaintext with S2V (AES-CMAC), then used as the counter of AES-CTR. The
+// same inputs therefore always give the same ciphertext.
+type siv struct {
+	mac cipher.Block
+	ctr cipher.Block
+}
+
+// newSIV takes a 32, 48 or 64 byte key, whose first half keys S2V and second half keys CTR.
+func newSIV(key []byte) (*siv, error) {
+	if len(key) != 32 && len(key) != 48 && len(key) != 64 {
+		return nil, errors.New("AES-SIV key must be 32, 48 or 64 bytes")
+	}
+
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, err
+	}
+	return &siv{mac: mac, ctr: ctr}, nil
+}
+
+// seal returns the synthetic IV followed by the encrypted plaintext.
+func (s *siv) seal(plaintext []byte, additionalData ...[]byte) []byte {
+	v := s.s2v(append(additionalData, plaintext))
+
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	copy(ciphertext, v)
+	s.xorKeyStream(ciphertext[aes.BlockSize:], plaintext, v)
+	return ciphertext
+}
+
+func (s *siv) open(ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize {
+		return nil, invalidCiphertext("invalid ciphertext")
+	}
+
+	v := ciphertext[:aes.BlockSize]
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	s.xorKeyStream(plaintext, ciphertext[aes.BlockSize:], v)
+
+	if subtle.ConstantTimeCompare(v, s.s2v(append(additionalData, plaintext))) != 1 {
+		return nil, authenticationFailed()
+	}
+	return plaintext, nil
+}
+
+func (s *siv) xorKeyStream(dst, src, v []byte) {
+	// The 31st and 63rd bits from the right are cleared so the counter can wrap on 32-bit words
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, v)
+	counter[8] &= 0x7f
+	counter[12] &= 0x7f
+
+	cipher.NewCTR(s.ctr, counter).XORKeyStream(dst, src)
+}
+
+// s2v computes the synthetic IV of the strings, the last of which is the plaintext.
+func (s *siv) s2v(strings [][]byte) []byte {
+	d := cmac(s.mac, make([]byte, aes.BlockSize))
+	for _, str := range strings[:len(strings)-1] {
+		d = dbl(d)
+		xorBytes(d, cmac(s.mac, str))
+	}
+
+	last := strings[len(strings)-1]
+	var t []byte
+	if len(last) >= aes.BlockSize {
+		t = append([]byte{}, last...)
+		xorBytes(t[len(t)-aes.BlockSize:], d)
+	} else {
+		t = dbl(d)
+		xorBytes(t, pad(last))
+	}
+	return cmac(s.mac, t)
+}
+
+// cmac computes the AES-CMAC of RFC 4493.
+func cmac(block cipher.Block, message []byte) []byte {
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	k1 = dbl(k1)
+	k2 := dbl(k1)
+
+	n := (len(message) + aes.BlockSize - 1) / aes.BlockSize
+	var last []byte
+	if n > 0 && len(message)%aes.BlockSize == 0 {
+		last = append([]byte{}, message[(n-1)*aes.BlockSize:]...)
+		xorBytes(last, k1)
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		last = pad(message[(n-1)*aes.BlockSize:])
+		xorBytes(last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		xorBytes(x, message[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	xorBytes(x, last)
+	block.Encrypt(x, x)
+	return x
+}
+
+// dbl multiplies a block by x in GF(2^128).
+func dbl(block []byte) []byte {
+	result := make([]byte, aes.BlockSize)
+	for i := 0; i < aes.BlockSize-1; i++ {
+		result[i] = block[i]<<1 | block[i+1]>>7
+	}
+	result[aes.BlockSize-1] = block[aes.BlockSize-1] << 1
+	if block[0]&0x80 != 0 {
+		result[aes.BlockSize-1] ^= 0x87
+	}
+	return result
+}
+
+// pad appends the 10* padding to a partial block.
+func pad(partial []byte) []byte {
+	block := make([]byte, aes.BlockSize)
+	copy(block, partial)
+	block[len(partial)] = 0x80
+	return block
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
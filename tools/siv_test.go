@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	return decoded
+}
+
+// Test vectors of RFC 4493 section 4
+func TestCMAC_RFC4493(t *testing.T) {
+	// Prepare
+	block, _ := aes.NewCipher(decodeHex(t, "2b7e151628aed2a6abf7158809cf4f3c"))
+	message := decodeHex(t, "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	vectors := map[int]string{
+		0:  "bb1d6929e95937287fa37d129b756746",
+		16: "070a16b46b4d4144f79bdd9dd04a287c",
+		40: "dfa66747de9ae63030ca32611497c827",
+		64: "51f0bebf7e3b9d92fc49741779363cfe",
+	}
+
+	for length, expected := range vectors {
+		// Perform
+		mac := cmac(block, message[:length])
+
+		// Check
+		assert.Equal(t, expected, hex.EncodeToString(mac), "length %d", length)
+	}
+}
+
+// Deterministic authenticated encryption example of RFC 5297 appendix A.1
+func TestSIV_RFC5297(t *testing.T) {
+	// Prepare
+	s, err := newSIV(decodeHex(t, "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff"))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	additionalData := decodeHex(t, "101112131415161718191a1b1c1d1e1f2021222324252627")
+	plaintext := decodeHex(t, "112233445566778899aabbccddee")
+
+	// Perform
+	ciphertext := s.seal(plaintext, additionalData)
+	opened, err := s.open(ciphertext, additionalData)
+
+	// Check
+	assert.Equal(t, "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c", hex.EncodeToString(ciphertext))
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+}
+
+func TestSIV_Open_Tampered(t *testing.T) {
+	// Prepare
+	s, _ := newSIV(make([]byte, 64))
+	ciphertext := s.seal([]byte("value1"), []byte("key1"))
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	// Perform
+	_, err := s.open(ciphertext, []byte("key1"))
+	_, errShort := s.open(ciphertext[:15], []byte("key1"))
+
+	// Check
+	assert.Error(t, err)
+	assert.Error(t, errShort)
+}
+
+// Nonce-based authenticated encryption example of RFC 5297 appendix A.2: several associated data
+// components and a plaintext of several blocks, the last one partial
+func TestSIV_RFC5297_SeveralComponents(t *testing.T) {
+	// Prepare
+	s, err := newSIV(decodeHex(t, "7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f"))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	additionalData := [][]byte{
+		decodeHex(t, "00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100"),
+		decodeHex(t, "102030405060708090a0"),
+		decodeHex(t, "09f911029d74e35bd84156c5635688c0"),
+	}
+	plaintext := decodeHex(t, "7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553")
+
+	// Perform
+	ciphertext := s.seal(plaintext, additionalData...)
+	opened, err := s.open(ciphertext, additionalData...)
+	_, errSwapped := s.open(ciphertext, additionalData[1], additionalData[0], additionalData[2])
+	_, errMissing := s.open(ciphertext, additionalData[:2]...)
+
+	// Check
+	assert.Equal(t, "7bdb6e3b432667eb06f4d14bff2fbd0fcb900f2fddbe404326601965c889bf17dba77ceb094fa663b7a3f748ba8af829ea64ad544a272e9c485b62a3fd5c0d", hex.EncodeToString(ciphertext))
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+	assert.Error(t, errSwapped)
+	assert.Error(t, errMissing)
+}
+
+func TestSIV_EmptyPlaintext(t *testing.T) {
+	// Prepare
+	s, _ := newSIV(make([]byte, 32))
+
+	// Perform
+	ciphertext := s.seal(nil, []byte("key1"))
+	opened, err := s.open(ciphertext, []byte("key1"))
+	_, errOtherData := s.open(ciphertext, []byte("key2"))
+	withoutData := s.seal(nil)
+	openedWithoutData, errWithoutData := s.open(withoutData)
+
+	// Check: only the synthetic IV, which still authenticates the associated data
+	assert.Len(t, ciphertext, 16)
+	assert.NoError(t, err)
+	assert.Empty(t, opened)
+	assert.Error(t, errOtherData)
+	assert.NotEqual(t, ciphertext, withoutData)
+	assert.NoError(t, errWithoutData)
+	assert.Empty(t, openedWithoutData)
+}
+
+func TestSIV_Open_TamperedTag(t *testing.T) {
+	// Prepare
+	s, _ := newSIV(make([]byte, 48))
+	plaintext := []byte("a value longer than one block")
+
+	for i := 0; i < 16; i++ {
+		ciphertext := s.seal(plaintext, []byte("key1"))
+		ciphertext[i] ^= 0x80
+
+		// Perform
+		_, err := s.open(ciphertext, []byte("key1"))
+
+		// Check
+		assert.Error(t, err, "byte %d", i)
+	}
+}
+
+func TestSIV_PartialBlocks(t *testing.T) {
+	// Prepare
+	s, _ := newSIV(make([]byte, 64))
+
+	for _, length := range []int{1, 15, 16, 17, 31, 33, 100} {
+		plaintext := make([]byte, length)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+
+		// Perform
+		ciphertext := s.seal(plaintext, []byte("key1"))
+		opened, err := s.open(ciphertext, []byte("key1"))
+
+		// Check
+		assert.Len(t, ciphertext, 16+length, "length %d", length)
+		assert.NoError(t, err, "length %d", length)
+		assert.Equal(t, plaintext, opened, "length %d", length)
+	}
+}
+
+func FuzzSIV(f *testing.F) {
+	f.Add([]byte(""), []byte(""), []byte(""))
+	f.Add([]byte("value1"), []byte("key1"), []byte("context"))
+	f.Add([]byte("a value longer than one block"), []byte("0123456789abcdef"), []byte(""))
+	s, _ := newSIV(make([]byte, 64))
+
+	f.Fuzz(func(t *testing.T, plaintext, field, context []byte) {
+		// Perform
+		ciphertext := s.seal(plaintext, field, context)
+		opened, err := s.open(ciphertext, field, context)
+
+		// Check
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		if !bytes.Equal(plaintext, opened) {
+			t.Fatalf("expected %x, but got %x", plaintext, opened)
+		}
+		if len(ciphertext) != 16+len(plaintext) {
+			t.Fatalf("expected %d bytes, but got %d", 16+len(plaintext), len(ciphertext))
+		}
+	})
+}
+
+func TestNewSIV_InvalidKey(t *testing.T) {
+	// Perform
+	_, err := newSIV(make([]byte, 16))
+
+	// Check
+	assert.Error(t, err)
+}
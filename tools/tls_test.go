@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCertificate is a certificate generated in memory, along with its private key
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// generateCertificate issues a certificate for the template, signed by the issuer or self-signed
+// when the issuer is nil.
+func generateCertificate(t *testing.T, template *x509.Certificate, issuer *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, parentKey := template, key
+	if issuer != nil {
+		parent, parentKey = issuer.certificate, issuer.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func generateCA(t *testing.T, name string) *testCertificate {
+	return generateCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func (c *testCertificate) writePEM(t *testing.T, dir, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	der, _ := x509.MarshalPKCS8PrivateKey(c.key)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	return certFile, keyFile
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.certificate.Raw}, PrivateKey: c.key}
+}
+
+// startTLSServer serves over TLS with the config.
+func startTLSServer(t *testing.T, config *tls.Config) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// Rejected handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = config
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTLSClient returns a client trusting the server CA, presenting the client certificate if any.
+func newTLSClient(serverCA *testCertificate, clientCertificate *testCertificate) *http.Client {
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(serverCA.certificate)
+	clientConfig := &tls.Config{RootCAs: rootCAs}
+	if clientCertificate != nil {
+		clientConfig.Certificates = []tls.Certificate{clientCertificate.tlsCertificate()}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	serverCA := generateCA(t, "Server CA")
+	serverCertificate := generateCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, serverCA)
+	certFile, keyFile := serverCertificate.writePEM(t, dir, "server")
+
+	// Perform
+	config, err := NewServerTLSConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	server := startTLSServer(t, config)
+	res, err := newTLSClient(serverCA, nil).Get(server.URL)
+
+	// Check
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+}
+
+func TestNewServerTLSConfig_ClientCA(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	serverCA := generateCA(t, "Server CA")
+	serverCertificate := generateCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, serverCA)
+	certFile, keyFile := serverCertificate.writePEM(t, dir, "server")
+
+	clientCA := generateCA(t, "Client CA")
+	clientCAFile, _ := clientCA.writePEM(t, dir, "client-ca")
+	clientTemplate := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "billing", Organization: []string{"Riot"}},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+	}
+	trusted := generateCertificate(t, clientTemplate(), clientCA)
+	untrusted := generateCertificate(t, clientTemplate(), generateCA(t, "Other CA"))
+
+	// Perform
+	config, err := NewServerTLSConfig(certFile, keyFile, clientCAFile)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	server := startTLSServer(t, config)
+	res, errTrusted := newTLSClient(serverCA, trusted).Get(server.URL)
+	_, errUntrusted := newTLSClient(serverCA, untrusted).Get(server.URL)
+	_, errAnonymous := newTLSClient(serverCA, nil).Get(server.URL)
+
+	// Check
+	assert.NoError(t, errTrusted)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Error(t, errUntrusted)
+	assert.Error(t, errAnonymous)
+}
+
+func TestNewServerTLSConfig_Invalid(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	certificate := generateCA(t, "localhost")
+	certFile, keyFile := certificate.writePEM(t, dir, "server")
+	notPEM := filepath.Join(dir, "not-pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	for name, files := range map[string][3]string{
+		"missing certificate":   {filepath.Join(dir, "missing"), keyFile, ""},
+		"key of another":        {certFile, writeOtherKey(t, dir), ""},
+		"missing client CA":     {certFile, keyFile, filepath.Join(dir, "missing")},
+		"client CA without PEM": {certFile, keyFile, notPEM},
+	} {
+		// Perform
+		_, err := NewServerTLSConfig(files[0], files[1], files[2])
+
+		// Check
+		assert.Error(t, err, name)
+	}
+}
+
+func writeOtherKey(t *testing.T, dir string) string {
+	_, keyFile := generateCA(t, "other").writePEM(t, dir, "other")
+	return keyFile
+}
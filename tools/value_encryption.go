@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"encoding/binary"
+	"riot-api/service"
+	"strconv"
+)
+
+// decryptError is a decryption failure the client caused. Its message is kept for logs and
+// tests, while errors.Is matches the service sentinel describing it.
+type decryptError struct {
+	message  string
+	sentinel error
+}
+
+func (e *decryptError) Error() string {
+	return e.message
+}
+
+func (e *decryptError) Unwrap() error {
+	return e.sentinel
+}
+
+// invalidCiphertext returns an error matching service.ErrInvalidCiphertext.
+func invalidCiphertext(message string) error {
+	return &decryptError{message: message, sentinel: service.ErrInvalidCiphertext}
+}
+
+// authenticationFailed returns an error matching service.ErrAuthenticationFailed.
+func authenticationFailed() error {
+	return &decryptError{message: "message authentication failed", sentinel: service.ErrAuthenticationFailed}
+}
+
+// openEnvelope returns the envelope of an encrypted value, checking it was produced by algorithm.
+// Values that are not envelopes were produced before envelopes existed, and are returned as the
+// payload of a v1 envelope without key ID.
+func openEnvelope(algorithm string, ciphertext string) (Envelope, error) {
+	if !IsEnvelope(ciphertext) {
+		return Envelope{Version: EnvelopeV1, Algorithm: algorithm, Payload: ciphertext}, nil
+	}
+
+	envelope, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if envelope.Algorithm != algorithm {
+		return Envelope{}, invalidCiphertext("unsupported algorithm " + envelope.Algorithm)
+	}
+	return envelope, nil
+}
+
+// recognizesEnvelope reports whether ciphertext is a valid envelope produced by algorithm.
+func recognizesEnvelope(algorithm string, ciphertext string) bool {
+	if !IsEnvelope(ciphertext) {
+		return false
+	}
+
+	envelope, err := ParseEnvelope(ciphertext)
+	return err == nil && envelope.Algorithm == algorithm
+}
+
+// Tags of the path segments in associated data
+const (
+	keySegment      = 'k'
+	indexSegment    = 'i'
+	anyIndexSegment = '*'
+)
+
+// anyIndex stands for every position of an array in the path of a binding
+type anyIndex struct{}
+
+// withoutIndexes returns the binding with its array indexes replaced by anyIndex, so a value gets
+// the same deterministic ciphertext at any position of an array.
+func withoutIndexes(binding service.Binding) service.Binding {
+	path := make([]interface{}, len(binding.Path))
+	for i, segment := range binding.Path {
+		if _, ok := segment.(int); ok {
+			segment = anyIndex{}
+		}
+		path[i] = segment
+	}
+	binding.Path = path
+	return binding
+}
+
+// associatedData encodes a binding as AEAD additional data: the number of path segments, then each
+// segment as its tag, its length and its bytes, an index being written in decimal and anyIndex
+// having no bytes, then the context. Lengths are 32-bit big-endian integers.
+func associatedData(binding service.Binding) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(binding.Path)))
+	for _, segment := range binding.Path {
+		tag, value := byte(keySegment), ""
+		switch s := segment.(type) {
+		case string:
+			value = s
+		case int:
+			tag, value = indexSegment, strconv.Itoa(s)
+		case anyIndex:
+			tag = anyIndexSegment
+		}
+		data = append(data, tag)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(value)))
+		data = append(data, value...)
+	}
+	return append(data, binding.Context...)
+}
@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"riot-api/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssociatedData_DistinctPaths(t *testing.T) {
+	// Prepare: paths with the same field name
+	collisions := map[string][2]service.Binding{
+		"key containing a slash": {
+			{Field: "/a/b", Path: []interface{}{"/a/b"}},
+			{Field: "/a/b", Path: []interface{}{"a", "b"}},
+		},
+		"index and key": {
+			{Field: "0", Path: []interface{}{0}},
+			{Field: "0", Path: []interface{}{"0"}},
+		},
+		"segment and context": {
+			{Path: []interface{}{"ab"}, Context: "c"},
+			{Path: []interface{}{"a"}, Context: "bc"},
+		},
+	}
+
+	for name, bindings := range collisions {
+		// Perform
+		first := associatedData(bindings[0])
+		second := associatedData(bindings[1])
+
+		// Check
+		assert.NotEqual(t, first, second, name)
+	}
+}
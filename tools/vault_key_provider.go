@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"riot-api/service"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export types of the Vault Transit export endpoint
+const (
+	VaultEncryptionKey = "encryption-key"
+	VaultSigningKey    = "signing-key"
+	VaultHMACKey       = "hmac-key"
+)
+
+// VaultKey names the Transit key serving a purpose, and the type its material is exported as.
+type VaultKey struct {
+	Name       string
+	ExportType string
+}
+
+// VaultKeyProvider reads exportable keys from a Vault Transit compatible secrets engine, through
+// GET /v1/<mount>/export/<type>/<name>. Each key version becomes a key with ID v<version>, and
+// the latest version is the active key. Keys are fetched on every call.
+type VaultKeyProvider struct {
+	address string
+	token   string
+	mount   string
+	keys    map[string]VaultKey
+	client  *http.Client
+}
+
+func NewVaultKeyProvider(address, token, mount string, keys map[string]VaultKey) *VaultKeyProvider {
+	return &VaultKeyProvider{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		keys:    keys,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type vaultExportResponse struct {
+	Data struct {
+		Keys map[string]string `json:"keys"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (p *VaultKeyProvider) GetKey(purpose string, id string) (service.Key, error) {
+	keys, err := p.ListKeys(purpose)
+	if err != nil {
+		return service.Key{}, err
+	}
+	return findKey(keys, purpose, id)
+}
+
+func (p *VaultKeyProvider) ActiveKey(purpose string) (service.Key, error) {
+	keys, err := p.ListKeys(purpose)
+	if err != nil {
+		return service.Key{}, err
+	}
+
+	active := keys[0]
+	for _, key := range keys[1:] {
+		if vaultVersion(key.ID) > vaultVersion(active.ID) {
+			active = key
+		}
+	}
+	return active, nil
+}
+
+func (p *VaultKeyProvider) ListKeys(purpose string) ([]service.Key, error) {
+	vaultKey, ok := p.keys[purpose]
+	if !ok {
+		return nil, fmt.Errorf("%w: no Vault key for %s", service.ErrNoActiveKey, purpose)
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s/export/%s/%s", p.address, p.mount, url.PathEscape(vaultKey.ExportType), url.PathEscape(vaultKey.Name))
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", p.token)
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("exporting Vault key %q: %w", vaultKey.Name, err)
+	}
+	defer response.Body.Close()
+
+	var export vaultExportResponse
+	if err := json.NewDecoder(response.Body).Decode(&export); err != nil && response.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("exporting Vault key %q: invalid response: %w", vaultKey.Name, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exporting Vault key %q: %s %s", vaultKey.Name, response.Status, strings.Join(export.Errors, ", "))
+	}
+	if len(export.Data.Keys) == 0 {
+		return nil, fmt.Errorf("%w: Vault key %q has no versions", service.ErrNoActiveKey, vaultKey.Name)
+	}
+
+	keys := make([]service.Key, 0, len(export.Data.Keys))
+	for version, material := range export.Data.Keys {
+		if _, err := strconv.Atoi(version); err != nil {
+			return nil, fmt.Errorf("exporting Vault key %q: invalid version %q", vaultKey.Name, version)
+		}
+		keys = append(keys, service.Key{ID: "v" + version, Purpose: purpose, Material: []byte(material)})
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func vaultVersion(id string) int {
+	version, _ := strconv.Atoi(strings.TrimPrefix(id, "v"))
+	return version
+}
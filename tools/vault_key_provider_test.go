@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"riot-api/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newVaultStandIn serves the Transit export endpoint for the given keys, by name then version,
+// whatever export type is asked for.
+func newVaultStandIn(t *testing.T, keys map[string]map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+
+		for name, versions := range keys {
+			for _, exportType := range []string{VaultEncryptionKey, VaultSigningKey, VaultHMACKey} {
+				if r.Method == http.MethodGet && r.URL.Path == "/v1/transit/export/"+exportType+"/"+name {
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"data": map[string]interface{}{"name": name, "keys": versions},
+					})
+					return
+				}
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVaultKeyProvider(t *testing.T) {
+	// Prepare
+	keyV1 := base64.StdEncoding.EncodeToString([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	keyV2 := base64.StdEncoding.EncodeToString([]byte(CHACHA20_ENCRYPTION_KEY))
+	server := newVaultStandIn(t, map[string]map[string]string{"riot": {"1": keyV1, "2": keyV2}})
+	provider := NewVaultKeyProvider(server.URL+"/", "test-token", "transit", map[string]VaultKey{
+		service.PurposeEncryption: {Name: "riot", ExportType: VaultEncryptionKey},
+	})
+
+	// Perform
+	keys, err := provider.ListKeys(service.PurposeEncryption)
+	active, errActive := provider.ActiveKey(service.PurposeEncryption)
+	retired, errRetired := provider.GetKey(service.PurposeEncryption, "v1")
+
+	// Check: the latest version is active
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.NoError(t, errActive)
+	assert.Equal(t, "v2", active.ID)
+	assert.Equal(t, []byte(keyV2), active.Material)
+	assert.NoError(t, errRetired)
+	assert.Equal(t, []byte(keyV1), retired.Material)
+}
+
+func TestVaultKeyProvider_KeyringEncryptsAcrossVersions(t *testing.T) {
+	// Prepare: encrypt under version 1, then rotate the Transit key to version 2
+	keyV1 := base64.StdEncoding.EncodeToString([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	keyV2 := base64.StdEncoding.EncodeToString([]byte(CHACHA20_ENCRYPTION_KEY))
+	keys := map[string]map[string]string{"riot": {"1": keyV1}}
+	server := newVaultStandIn(t, keys)
+	provider := NewVaultKeyProvider(server.URL, "test-token", "transit", map[string]VaultKey{
+		service.PurposeEncryption: {Name: "riot", ExportType: VaultEncryptionKey},
+	})
+	decode := func(material []byte) ([]byte, error) { return DecodeKey(string(material), AES256KeySize) }
+
+	keyring, err := NewKeyringFromProvider(provider, service.PurposeEncryption, decode)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	oldEncryptor, _ := NewAESKeyringEncryptor(keyring)
+	ciphertext, _ := oldEncryptor.EncryptValue(service.KeyBinding("key1", ""), "value1")
+	keys["riot"]["2"] = keyV2
+
+	// Perform
+	keyring, err = NewKeyringFromProvider(provider, service.PurposeEncryption, decode)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	encryptor, _ := NewAESKeyringEncryptor(keyring)
+	plaintext, err := encryptor.DecryptValue(service.KeyBinding("key1", ""), ciphertext)
+
+	// Check
+	assert.Equal(t, "v2", keyring.ActiveID())
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", plaintext)
+}
+
+func TestVaultKeyProvider_SigningKeyExports(t *testing.T) {
+	// Prepare: the payloads Transit exports for each type of signing key
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sec1, _ := x509.MarshalECPrivateKey(ecdsaKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, RSAMinimumKeyBits)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	exports := map[string]string{
+		"ecdsa":   string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})),
+		"rsa":     string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})),
+		"ed25519": base64.StdEncoding.EncodeToString(ed25519Key),
+	}
+	keys := make(map[string]map[string]string)
+	for name, export := range exports {
+		keys[name] = map[string]string{"1": export}
+	}
+	server := newVaultStandIn(t, keys)
+
+	for name, expected := range map[string]privateKey{"ecdsa": ecdsaKey, "rsa": rsaKey, "ed25519": ed25519Key} {
+		provider := NewVaultKeyProvider(server.URL, "test-token", "transit", map[string]VaultKey{
+			service.PurposeSigning: {Name: name, ExportType: VaultSigningKey},
+		})
+
+		// Perform
+		key, err := provider.ActiveKey(service.PurposeSigning)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+		parsed, err := ParsePrivateKey(string(key.Material))
+
+		// Check
+		assert.NoError(t, err, name)
+		assert.True(t, expected.Equal(parsed), name)
+	}
+}
+
+func TestVaultKeyProvider_HMACKeyExport(t *testing.T) {
+	// Prepare: Transit exports HMAC keys base64 encoded
+	export := base64.StdEncoding.EncodeToString([]byte(AES_256_GCM_ENCRYPTION_KEY))
+	server := newVaultStandIn(t, map[string]map[string]string{"riot-hmac": {"1": export}})
+	provider := NewVaultKeyProvider(server.URL, "test-token", "transit", map[string]VaultKey{
+		service.PurposeSigning: {Name: "riot-hmac", ExportType: VaultHMACKey},
+	})
+
+	// Perform
+	keyring, err := NewKeyringFromProvider(provider, service.PurposeSigning, func(material []byte) ([]byte, error) {
+		return material, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	signature, err := NewHMACKeyringSigner(keyring).Sign(map[string]interface{}{"key1": "value1"})
+
+	// Check: the exported key text is the secret
+	assert.NoError(t, err)
+	assert.Equal(t, "v1"+KeyIDSeparator, signature[:len("v1"+KeyIDSeparator)])
+	result, _ := NewHMACSigner([]byte(export)).Verify(map[string]interface{}{"key1": "value1"}, signature[len("v1"+KeyIDSeparator):])
+	assert.True(t, result.Valid)
+}
+
+func TestVaultKeyProvider_Errors(t *testing.T) {
+	// Prepare
+	server := newVaultStandIn(t, map[string]map[string]string{"empty": {}})
+	keys := map[string]VaultKey{
+		service.PurposeEncryption: {Name: "missing", ExportType: VaultEncryptionKey},
+		service.PurposeSigning:    {Name: "empty", ExportType: VaultEncryptionKey},
+	}
+
+	// Perform
+	_, errMissing := NewVaultKeyProvider(server.URL, "test-token", "transit", keys).ActiveKey(service.PurposeEncryption)
+	_, errEmpty := NewVaultKeyProvider(server.URL, "test-token", "transit", keys).ActiveKey(service.PurposeSigning)
+	_, errToken := NewVaultKeyProvider(server.URL, "wrong-token", "transit", keys).ActiveKey(service.PurposeSigning)
+	_, errPurpose := NewVaultKeyProvider(server.URL, "test-token", "transit", nil).ActiveKey(service.PurposeSigning)
+
+	// Check
+	assert.ErrorContains(t, errMissing, "404")
+	assert.ErrorIs(t, errEmpty, service.ErrNoActiveKey)
+	assert.ErrorContains(t, errToken, "permission denied")
+	assert.ErrorIs(t, errPurpose, service.ErrNoActiveKey)
+}